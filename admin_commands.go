@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/z-sk1/signin-api/internal/auth"
+	leaderboard "github.com/z-sk1/signin-api/internal/bateenfest"
+	"github.com/z-sk1/signin-api/internal/config"
+	"github.com/z-sk1/signin-api/internal/db"
+	"github.com/z-sk1/signin-api/internal/keep-track/expenses"
+	"github.com/z-sk1/signin-api/internal/listquery"
+	"github.com/z-sk1/signin-api/internal/remind-me/notes"
+	"github.com/z-sk1/signin-api/internal/remind-me/reminders"
+	"github.com/z-sk1/signin-api/internal/server"
+	"github.com/z-sk1/signin-api/internal/validation"
+)
+
+// openStores connects for an admin command. It refuses to run against a
+// schema that isn't fully migrated rather than migrating behind your back
+func openStores(cfg *config.Config) server.Stores {
+	mustValidate(cfg)
+	db.Open(cfg.Database)
+
+	pending, err := db.DB.PendingMigrations(context.Background())
+	if err != nil {
+		log.Fatal("Could not read the schema version, run signin-api migrate up first: ", err)
+	}
+	if pending > 0 {
+		log.Fatalf("%d migrations pending, run signin-api migrate up first", pending)
+	}
+
+	return server.SQLStores(db.DB)
+}
+
+// parseArgs parses a subcommand's flags and requires exactly n positional arguments
+func parseArgs(fs *flag.FlagSet, args []string, n int, positional string) []string {
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: signin-api %s [flags] %s\n", fs.Name(), positional)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != n {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	return fs.Args()
+}
+
+// readPassword returns the contents of file, or prompts on stdin when file is empty
+func readPassword(file string) string {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return strings.TrimRight(string(data), "\r\n")
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		log.Fatal("no password given")
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		log.Fatal("no password given")
+	}
+	return password
+}
+
+func writeJSON(w io.Writer, v any) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runCreateUser(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("create-user", flag.ExitOnError)
+	role := fs.String("role", "user", "user or admin")
+	passwordFile := fs.String("password-file", "", "file holding the password; prompts when empty")
+	pos := parseArgs(fs, args, 2, "<username> <email>")
+
+	if !auth.ValidRole(*role) {
+		log.Fatalf("invalid role %q (want user or admin)", *role)
+	}
+
+	password := readPassword(*passwordFile)
+	stores := openStores(cfg)
+
+	if err := createUser(context.Background(), stores, pos[0], pos[1], password, *role); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("User %q created with role %s\n", pos[0], *role)
+}
+
+// createUser holds the account to the same rules as POST /signup
+func createUser(ctx context.Context, stores server.Stores, username, email, password, role string) error {
+	return auth.CreateAccount(ctx, stores.Users, auth.User{
+		Username: username,
+		Email:    email,
+		Password: password,
+		Role:     role,
+	})
+}
+
+func runSetRole(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("set-role", flag.ExitOnError)
+	pos := parseArgs(fs, args, 2, "<username> <user|admin>")
+
+	if !auth.ValidRole(pos[1]) {
+		log.Fatalf("invalid role %q (want user or admin)", pos[1])
+	}
+
+	if err := setRole(context.Background(), openStores(cfg), pos[0], pos[1]); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("User %q is now %s\n", pos[0], pos[1])
+}
+
+func setRole(ctx context.Context, stores server.Stores, username, role string) error {
+	if !auth.ValidRole(role) {
+		return fmt.Errorf("invalid role %q (want user or admin)", role)
+	}
+	return userError(username, stores.Users.SetRole(ctx, username, role))
+}
+
+func runResetPassword(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("reset-password", flag.ExitOnError)
+	passwordFile := fs.String("password-file", "", "file holding the new password; prompts when empty")
+	pos := parseArgs(fs, args, 1, "<username>")
+
+	password := readPassword(*passwordFile)
+	stores := openStores(cfg)
+
+	if err := resetPassword(context.Background(), stores, pos[0], password); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Password for %q reset\n", pos[0])
+}
+
+func resetPassword(ctx context.Context, stores server.Stores, username, password string) error {
+	user, err := stores.Users.FindUserByUsername(ctx, username)
+	if err != nil {
+		return userError(username, err)
+	}
+	if err := auth.ValidatePassword(password); err != nil {
+		return err
+	}
+
+	hashed, err := auth.HashPassword(ctx, password)
+	if err != nil {
+		return err
+	}
+
+	// also drops any pending reset tokens for the account
+	return stores.Users.ResetPassword(ctx, user.Email, hashed)
+}
+
+func runDisableUser(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("disable-user", flag.ExitOnError)
+	enable := fs.Bool("enable", false, "re-enable the account instead")
+	pos := parseArgs(fs, args, 1, "<username>")
+
+	stores := openStores(cfg)
+	if err := stores.Users.SetDisabled(context.Background(), pos[0], !*enable); err != nil {
+		log.Fatal(userError(pos[0], err))
+	}
+
+	if *enable {
+		fmt.Printf("User %q enabled\n", pos[0])
+	} else {
+		fmt.Printf("User %q disabled\n", pos[0])
+	}
+}
+
+func runPurgeExpiredResets(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("purge-expired-resets", flag.ExitOnError)
+	parseArgs(fs, args, 0, "")
+
+	stores := openStores(cfg)
+	purged, err := stores.Users.PurgeExpiredResets(context.Background(), time.Now().Unix())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Purged %d expired password resets\n", purged)
+}
+
+// userExport is everything stored about one account, minus its password
+type userExport struct {
+	User struct {
+		ID       int    `json:"id"`
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		Role     string `json:"role"`
+		Disabled bool   `json:"disabled"`
+	} `json:"user"`
+	Notes       []notes.Note                   `json:"notes"`
+	Reminders   []reminders.Reminder           `json:"reminders"`
+	Expenses    []expenses.Expense             `json:"expenses"`
+	Leaderboard []leaderboard.LeaderboardEntry `json:"leaderboard"`
+}
+
+func runExportUser(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("export-user", flag.ExitOnError)
+	pos := parseArgs(fs, args, 1, "<username>")
+
+	export, err := exportUser(context.Background(), openStores(cfg), pos[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	writeJSON(os.Stdout, export)
+}
+
+func exportUser(ctx context.Context, stores server.Stores, username string) (*userExport, error) {
+	user, err := stores.Users.FindUserByUsername(ctx, username)
+	if err != nil {
+		return nil, userError(username, err)
+	}
+
+	export := &userExport{
+		Notes:       []notes.Note{},
+		Reminders:   []reminders.Reminder{},
+		Expenses:    []expenses.Expense{},
+		Leaderboard: []leaderboard.LeaderboardEntry{},
+	}
+	export.User.ID = user.ID
+	export.User.Username = user.Username
+	export.User.Email = user.Email
+	export.User.Role = user.Role
+	export.User.Disabled = user.Disabled
+
+	// the zero query is every row, unpaged
+	userNotes, err := stores.Notes.List(ctx, user.ID, listquery.Query{})
+	if err != nil {
+		return nil, err
+	}
+	userReminders, err := stores.Reminders.List(ctx, user.ID, listquery.Query{})
+	if err != nil {
+		return nil, err
+	}
+	userExpenses, err := stores.Expenses.List(ctx, user.ID, listquery.Query{})
+	if err != nil {
+		return nil, err
+	}
+
+	export.Notes = append(export.Notes, userNotes.Items...)
+	export.Reminders = append(export.Reminders, userReminders.Items...)
+	export.Expenses = append(export.Expenses, userExpenses.Items...)
+
+	// entries the account added as an admin
+	entries, err := stores.Leaderboard.ListAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.UserID == user.ID {
+			export.Leaderboard = append(export.Leaderboard, entry)
+		}
+	}
+
+	return export, nil
+}
+
+func runLeaderboard(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "export":
+		fs := flag.NewFlagSet("leaderboard export", flag.ExitOnError)
+		section := fs.String("section", "", "only export this section")
+		parseArgs(fs, args[1:], 0, "")
+
+		entries, err := exportLeaderboard(context.Background(), openStores(cfg), *section)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		writeJSON(os.Stdout, entries)
+
+	case "import":
+		fs := flag.NewFlagSet("leaderboard import", flag.ExitOnError)
+		owner := fs.String("owner", "", "admin account recorded as adding the entries (required)")
+		pos := parseArgs(fs, args[1:], 1, "<file.json|->")
+
+		if *owner == "" {
+			log.Fatal("-owner is required")
+		}
+
+		var in io.Reader = os.Stdin
+		if pos[0] != "-" {
+			f, err := os.Open(pos[0])
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			in = f
+		}
+
+		n, err := importLeaderboard(context.Background(), openStores(cfg), *owner, in)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Imported %d leaderboard entries\n", n)
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown leaderboard command %q\n\n%s", args[0], usage)
+		os.Exit(2)
+	}
+}
+
+func exportLeaderboard(ctx context.Context, stores server.Stores, section string) ([]leaderboard.LeaderboardEntry, error) {
+	entries, err := stores.Leaderboard.ListAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []leaderboard.LeaderboardEntry{}
+	for _, entry := range entries {
+		if section == "" || entry.Section == section {
+			out = append(out, entry)
+		}
+	}
+	return out, nil
+}
+
+// importLeaderboard adds every entry in the JSON array read from in, as added
+// by owner, or none of them
+func importLeaderboard(ctx context.Context, stores server.Stores, owner string, in io.Reader) (int, error) {
+	var entries []leaderboard.LeaderboardEntry
+	if err := json.NewDecoder(in).Decode(&entries); err != nil {
+		return 0, fmt.Errorf("invalid leaderboard file: %w", err)
+	}
+
+	// same rules the API applies to submitted scores
+	validation.Register()
+	for i := range entries {
+		if err := binding.Validator.ValidateStruct(&entries[i]); err != nil {
+			return 0, fmt.Errorf("entry %d: %w", i, err)
+		}
+	}
+
+	user, err := stores.Users.FindUserByUsername(ctx, owner)
+	if err != nil {
+		return 0, userError(owner, err)
+	}
+
+	err = stores.Atomic(ctx, func(ctx context.Context) error {
+		for i, entry := range entries {
+			entry.UserID = user.ID
+			entry.Username = user.Username
+			if err := stores.Leaderboard.Add(ctx, &entry); err != nil {
+				return fmt.Errorf("entry %d: %w", i, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// userError gives a friendlier message for unknown usernames
+func userError(username string, err error) error {
+	if errors.Is(err, db.ErrNotFound) {
+		return fmt.Errorf("no user named %q", username)
+	}
+	return err
+}
+
+func runBackup(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	output := fs.String("o", "", "archive to write; stdout when empty")
+	parseArgs(fs, args, 0, "")
+
+	mustValidate(cfg)
+	db.Open(cfg.Database)
+	defer db.DB.Close()
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	stats, err := db.DB.Backup(context.Background(), out)
+	if err != nil {
+		if *output != "" {
+			os.Remove(*output)
+		}
+		log.Fatal("Backup failed: ", err)
+	}
+
+	printBackupStats("Backed up", stats)
+}
+
+func runRestore(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	pos := parseArgs(fs, args, 1, "<file|->")
+
+	var in io.Reader = os.Stdin
+	if pos[0] != "-" {
+		f, err := os.Open(pos[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	mustValidate(cfg)
+	db.Open(cfg.Database)
+	defer db.DB.Close()
+
+	stats, err := db.DB.Restore(context.Background(), in)
+	if err != nil {
+		log.Fatal("Restore failed: ", err)
+	}
+
+	printBackupStats("Restored", stats)
+}
+
+// printBackupStats goes to stderr so it never mixes with an archive on stdout
+func printBackupStats(verb string, stats *db.BackupStats) {
+	tables := make([]string, 0, len(stats.Rows))
+	for table := range stats.Rows {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	fmt.Fprintf(os.Stderr, "%s schema version %d:\n", verb, stats.SchemaVersion)
+	for _, table := range tables {
+		fmt.Fprintf(os.Stderr, "  %-16s %d rows\n", table, stats.Rows[table])
+	}
+}
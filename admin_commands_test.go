@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/z-sk1/signin-api/internal/auth"
+	leaderboard "github.com/z-sk1/signin-api/internal/bateenfest"
+	"github.com/z-sk1/signin-api/internal/db"
+	"github.com/z-sk1/signin-api/internal/server"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func openTestStores(t *testing.T) server.Stores {
+	t.Helper()
+
+	conn, err := db.Connect(db.SQLite, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if err := conn.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	return server.SQLStores(conn)
+}
+
+func TestCreateUser(t *testing.T) {
+	ctx := context.Background()
+	stores := openTestStores(t)
+
+	tests := []struct {
+		name                            string
+		username, email, password, role string
+		want                            error
+	}{
+		{"user", "sam", "sam@example.com", "hunter22", "user", nil},
+		{"admin", "root", "root@example.com", "rootpass", "admin", nil},
+		{"taken username", "sam", "other@example.com", "hunter22", "user", auth.ErrUserExists},
+		{"taken email", "kim", "sam@example.com", "hunter22", "user", auth.ErrUserExists},
+		{"no username", "", "kim@example.com", "hunter22", "user", auth.ErrInvalidAccount},
+		{"no email", "kim", "", "hunter22", "user", auth.ErrInvalidAccount},
+		{"bad email", "kim", "kim", "hunter22", "user", auth.ErrInvalidAccount},
+		{"short password", "kim", "kim@example.com", "short", "user", auth.ErrInvalidAccount},
+		{"long password", "kim", "kim@example.com", strings.Repeat("x", 73), "user", auth.ErrInvalidAccount},
+		{"bad role", "kim", "kim@example.com", "hunter22", "owner", auth.ErrInvalidAccount},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := createUser(ctx, stores, tc.username, tc.email, tc.password, tc.role)
+			if !errors.Is(err, tc.want) || (tc.want == nil) != (err == nil) {
+				t.Fatalf("createUser: %v, want %v", err, tc.want)
+			}
+		})
+	}
+
+	root, err := stores.Users.FindUserByUsername(ctx, "root")
+	if err != nil || root.Role != "admin" {
+		t.Fatalf("root = %+v, %v", root, err)
+	}
+	if _, err := stores.Users.FindUserByUsername(ctx, "kim"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("an invalid account was created: %v", err)
+	}
+}
+
+func TestUserCommands(t *testing.T) {
+	ctx := context.Background()
+	stores := openTestStores(t)
+	if err := createUser(ctx, stores, "sam", "sam@example.com", "hunter22", "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		run  func() error
+		// want is part of the error, or "" for none
+		want string
+	}{
+		{"set role", func() error { return setRole(ctx, stores, "sam", "admin") }, ""},
+		{"set bad role", func() error { return setRole(ctx, stores, "sam", "owner") }, `invalid role "owner"`},
+		{"set role of nobody", func() error { return setRole(ctx, stores, "nobody", "user") }, `no user named "nobody"`},
+		{"reset password", func() error { return resetPassword(ctx, stores, "sam", "newpass1") }, ""},
+		{"reset to no password", func() error { return resetPassword(ctx, stores, "sam", "") }, "invalid account: password is required"},
+		{"reset to short password", func() error { return resetPassword(ctx, stores, "sam", "short") }, "password must be at least 8 characters"},
+		{"reset to long password", func() error { return resetPassword(ctx, stores, "sam", strings.Repeat("x", 73)) }, "password must be at most 72 characters"},
+		{"reset password of nobody", func() error { return resetPassword(ctx, stores, "nobody", "newpass1") }, `no user named "nobody"`},
+		{"export nobody", func() error { _, err := exportUser(ctx, stores, "nobody"); return err }, `no user named "nobody"`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.run()
+			if tc.want == "" && err != nil || tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)) {
+				t.Fatalf("got %v, want %q", err, tc.want)
+			}
+		})
+	}
+
+	user, err := stores.Users.FindUserByUsername(ctx, "sam")
+	if err != nil || user.Role != "admin" || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("newpass1")) != nil {
+		t.Fatalf("sam = %+v, %v", user, err)
+	}
+
+	export, err := exportUser(ctx, stores, "sam")
+	if err != nil || export.User.Username != "sam" || export.User.Role != "admin" || export.Notes == nil || export.Leaderboard == nil {
+		t.Fatalf("exportUser = %+v, %v", export, err)
+	}
+}
+
+// failingLeaderboard fails every Add after the first n
+type failingLeaderboard struct {
+	leaderboard.Repository
+	n int
+}
+
+func (r *failingLeaderboard) Add(ctx context.Context, entry *leaderboard.LeaderboardEntry) error {
+	if r.n == 0 {
+		return errors.New("disk full")
+	}
+	r.n--
+	return r.Repository.Add(ctx, entry)
+}
+
+func TestLeaderboardImport(t *testing.T) {
+	ctx := context.Background()
+	const entries = `[{"section": "a", "name": "x", "points": 3}, {"section": "b", "name": "y", "points": 5}]`
+
+	tests := []struct {
+		name  string
+		owner string
+		file  string
+		// failAfter makes the store fail after that many entries, when set
+		failAfter int
+		want      string
+	}{
+		{"imports", "root", entries, 0, ""},
+		{"not json", "root", `{"section"`, 0, "invalid leaderboard file"},
+		{"invalid entry", "root", `[{"section": "a", "name": "x"}, {"section": "", "name": "y"}]`, 0, "entry 1"},
+		{"unknown owner", "nobody", entries, 0, `no user named "nobody"`},
+		{"store fails midway", "root", entries, 1, "entry 1: disk full"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stores := openTestStores(t)
+			if err := createUser(ctx, stores, "root", "root@example.com", "rootpass", "admin"); err != nil {
+				t.Fatal(err)
+			}
+			store := stores.Leaderboard
+			if tc.failAfter > 0 {
+				stores.Leaderboard = &failingLeaderboard{Repository: store, n: tc.failAfter}
+			}
+
+			n, err := importLeaderboard(ctx, stores, tc.owner, strings.NewReader(tc.file))
+			if tc.want == "" && err != nil || tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)) {
+				t.Fatalf("importLeaderboard: %v, want %q", err, tc.want)
+			}
+
+			// an import is all or nothing
+			all, err := store.ListAll(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := map[bool]int{true: 2, false: 0}[tc.want == ""]; len(all) != want || n != want {
+				t.Fatalf("imported %d, stored %d entries, want %d", n, len(all), want)
+			}
+			if tc.want == "" && (all[0].UserID != 1 || all[1].Points != 5) {
+				t.Fatalf("entries %+v", all)
+			}
+		})
+	}
+}
+
+func TestLeaderboardExport(t *testing.T) {
+	ctx := context.Background()
+	stores := openTestStores(t)
+	if err := createUser(ctx, stores, "root", "root@example.com", "rootpass", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	const entries = `[{"section": "a", "name": "x", "points": 3}, {"section": "b", "name": "y", "points": 5}]`
+	if _, err := importLeaderboard(ctx, stores, "root", strings.NewReader(entries)); err != nil {
+		t.Fatal(err)
+	}
+
+	for section, want := range map[string]int{"": 2, "a": 1, "c": 0} {
+		got, err := exportLeaderboard(ctx, stores, section)
+		if err != nil || got == nil || len(got) != want {
+			t.Fatalf("exportLeaderboard(%q) = %+v, %v; want %d entries", section, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/z-sk1/signin-api/internal/auth"
+	"github.com/z-sk1/signin-api/internal/config"
+	"github.com/z-sk1/signin-api/internal/db"
+)
+
+const usage = `usage: signin-api [flags] [command]
+
+With no command the HTTP server is started.
+
+commands:
+  migrate up          apply all pending migrations
+  migrate down [n]    revert the last n migrations (default 1)
+  migrate status      list migrations and whether they are applied
+  config              print the effective configuration with secrets redacted
+  bootstrap-admin     create the first admin account; flags -username, -email
+                      and -password-file default to the admin.* settings, and
+                      the password is read from stdin when none is configured
+
+admin commands (the schema must be migrated; passwords are read from
+-password-file or prompted for on stdin):
+  create-user [-role user|admin] [-password-file f] <username> <email>
+  set-role <username> <user|admin>
+  reset-password [-password-file f] <username>
+  disable-user [-enable] <username>
+  purge-expired-resets
+  export-user <username>                 print the account and its data as JSON
+  leaderboard export [-section s]        print leaderboard entries as JSON
+  leaderboard import -owner <admin> <file.json|->
+  backup [-o file]                       write a compressed logical backup of
+                                         every table (stdout by default)
+  restore <file|->                       load a backup into an empty database
+
+Settings come from defaults, then the -config JSON file, then environment
+variables, then flags. Run signin-api -h to list every flag and its env var.
+`
+
+func runCommand(cfg *config.Config, args []string) {
+	switch args[0] {
+	case "migrate":
+		runMigrate(cfg, args[1:])
+	case "config":
+		runConfig(cfg)
+	case "bootstrap-admin":
+		runBootstrapAdmin(cfg, args[1:])
+	case "create-user":
+		runCreateUser(cfg, args[1:])
+	case "set-role":
+		runSetRole(cfg, args[1:])
+	case "reset-password":
+		runResetPassword(cfg, args[1:])
+	case "disable-user":
+		runDisableUser(cfg, args[1:])
+	case "purge-expired-resets":
+		runPurgeExpiredResets(cfg, args[1:])
+	case "export-user":
+		runExportUser(cfg, args[1:])
+	case "leaderboard":
+		runLeaderboard(cfg, args[1:])
+	case "backup":
+		runBackup(cfg, args[1:])
+	case "restore":
+		runRestore(cfg, args[1:])
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		os.Exit(2)
+	}
+}
+
+// mustValidate stops a command early when the config can't work, and
+// otherwise switches to the configured logger
+func mustValidate(cfg *config.Config) {
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	setupLogging(cfg)
+}
+
+func runConfig(cfg *config.Config) {
+	out, err := json.MarshalIndent(cfg.Redacted(), "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(out))
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "\nconfiguration is invalid:\n%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runMigrate(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	mustValidate(cfg)
+	db.Open(cfg.Database)
+
+	switch args[0] {
+	case "up":
+		if err := db.DB.MigrateUp(); err != nil {
+			log.Fatal(err)
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				log.Fatalf("invalid step count %q", args[1])
+			}
+			steps = n
+		}
+
+		if err := db.DB.MigrateDown(steps); err != nil {
+			log.Fatal(err)
+		}
+
+	case "status":
+		statuses, err := db.DB.Status()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		w.Flush()
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q\n\n%s", args[0], usage)
+		os.Exit(2)
+	}
+}
+
+func runBootstrapAdmin(cfg *config.Config, args []string) {
+	admin := cfg.Admin
+
+	fs := flag.NewFlagSet("bootstrap-admin", flag.ExitOnError)
+	fs.StringVar(&admin.Username, "username", admin.Username, "admin username")
+	fs.StringVar(&admin.Email, "email", admin.Email, "admin email")
+	fs.StringVar(&admin.PasswordFile, "password-file", admin.PasswordFile, "file holding the admin password")
+	fs.Parse(args)
+
+	password, err := admin.LoadPassword()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if password == "" {
+		password = readPassword("")
+	}
+
+	mustValidate(cfg)
+	db.InitDB(cfg.Database)
+	defer db.DB.Close()
+
+	err = auth.CreateFirstAdmin(context.Background(), auth.NewSQLRepository(db.DB), auth.User{
+		Username: admin.Username,
+		Email:    admin.Email,
+		Password: password,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Admin account %q created\n", admin.Username)
+}
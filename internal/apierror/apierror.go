@@ -0,0 +1,217 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/z-sk1/signin-api/internal/logging"
+)
+
+// ContentType is the RFC 7807 media type every error response uses
+const ContentType = "application/problem+json"
+
+// stable codes clients can switch on; the detail text may change, these won't
+const (
+	CodeInvalidRequest     = "invalid_request"
+	CodeValidationFailed   = "validation_failed"
+	CodeRequestTooLarge    = "request_too_large"
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidToken       = "invalid_token"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeAccountDisabled    = "account_disabled"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeRetired            = "retired"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeAlreadyExists      = "already_exists"
+	CodeVersionMismatch    = "version_mismatch"
+	CodeIfMatchRequired    = "if_match_required"
+	CodeIdempotencyReused  = "idempotency_key_reused"
+	CodeIdempotencyInUse   = "idempotency_key_in_use"
+	CodeInvalidResetToken  = "invalid_reset_token"
+	CodeInvalidSetupToken  = "invalid_setup_token"
+	CodeSetupUnavailable   = "setup_unavailable"
+	CodeInternal           = "internal_error"
+)
+
+// Error is an API failure with the status and code it's reported under.
+// Err holds the underlying cause, which is logged but never sent
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	Fields []FieldError
+	Err    error
+}
+
+// FieldError describes one invalid field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Detail, e.Err)
+	}
+	return e.Code + ": " + e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func New(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+func NotFound(detail string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, detail)
+}
+
+// Internal wraps an unexpected failure; only detail reaches the client
+func Internal(detail string, err error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Detail: detail, Err: err}
+}
+
+// InvalidField reports a single field that failed validation
+func InvalidField(field, code, message string) *Error {
+	return &Error{
+		Status: http.StatusBadRequest,
+		Code:   CodeValidationFailed,
+		Detail: "request validation failed",
+		Fields: []FieldError{{Field: field, Code: code, Message: message}},
+	}
+}
+
+// Bind turns a request body decoding or validation error into a response,
+// naming every field that had the wrong type or broke a binding rule
+func Bind(err error) *Error {
+	var invalid validator.ValidationErrors
+	if errors.As(err, &invalid) {
+		fields := make([]FieldError, len(invalid))
+		for i, fe := range invalid {
+			fields[i] = FieldError{Field: fe.Field(), Code: fe.Tag(), Message: fieldMessage(fe)}
+		}
+		return &Error{Status: http.StatusBadRequest, Code: CodeValidationFailed, Detail: "request validation failed", Fields: fields}
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return New(http.StatusRequestEntityTooLarge, CodeRequestTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return InvalidField(typeErr.Field, "invalid_type", "must be a "+typeErr.Type.String())
+	}
+
+	if errors.Is(err, io.EOF) {
+		return New(http.StatusBadRequest, CodeInvalidRequest, "request body is empty")
+	}
+
+	return &Error{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Detail: "request body is not valid JSON", Err: err}
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	unit := ""
+	if fe.Kind() == reflect.String {
+		unit = " characters"
+	}
+
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "max":
+		return "must be at most " + fe.Param() + unit
+	case "min":
+		return "must be at least " + fe.Param() + unit
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte":
+		return "must be at least " + fe.Param()
+	case "email":
+		return "must be an email address"
+	case "rfc3339":
+		return "must be an RFC 3339 timestamp"
+	case "currency":
+		return "must be an ISO 4217 currency code"
+	}
+	return "failed the " + fe.Tag() + " rule"
+}
+
+// Abort records err for Middleware to render and stops the handler chain
+func Abort(c *gin.Context, err *Error) {
+	c.Error(err)
+	c.Abort()
+}
+
+// Problem is the RFC 7807 body, extended with code, request_id and errors
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// Middleware renders the last error a handler recorded with Abort as
+// problem+json, and turns panics and unexpected errors into a logged 500
+func Middleware(c *gin.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.Abort()
+			write(c, Internal("internal error", fmt.Errorf("panic: %v", r)))
+		}
+	}()
+
+	c.Next()
+
+	if len(c.Errors) == 0 || c.Writer.Written() {
+		return
+	}
+
+	var apiErr *Error
+	if !errors.As(c.Errors.Last().Err, &apiErr) {
+		apiErr = Internal("internal error", c.Errors.Last().Err)
+	}
+	write(c, apiErr)
+}
+
+func write(c *gin.Context, err *Error) {
+	ctx := c.Request.Context()
+
+	if err.Status >= http.StatusInternalServerError {
+		slog.ErrorContext(ctx, err.Detail, "error", err.Err, "route", c.FullPath())
+	}
+
+	p := err.Problem()
+	p.Instance = c.Request.URL.Path
+	p.RequestID = logging.RequestID(ctx)
+
+	c.Header("Content-Type", ContentType)
+	c.JSON(err.Status, p)
+}
+
+// Problem is the body the error is sent as, without the request details
+func (e *Error) Problem() Problem {
+	return Problem{
+		Type:   "urn:signin-api:problem:" + e.Code,
+		Title:  http.StatusText(e.Status),
+		Status: e.Status,
+		Code:   e.Code,
+		Detail: e.Detail,
+		Errors: e.Fields,
+	}
+}
@@ -2,31 +2,53 @@ package auth
 
 import (
 	"crypto/rand"
-	"database/sql"
 	"encoding/hex"
-	"fmt"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/z-sk1/signin-api/internal/apierror"
 	"github.com/z-sk1/signin-api/internal/db"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/z-sk1/signin-api/internal/metrics"
 )
 
-var JwtKey []byte
-
-func init() {
-	JwtKey = getOrCreateSecret()
+type Handler struct {
+	Repo Repository
+	Key  []byte
+	// TokenTTL is how long login tokens last, ResetTTL how long reset tokens do
+	TokenTTL time.Duration
+	ResetTTL time.Duration
+}
 
-	fmt.Printf("jwt key: %s...", string(JwtKey)[:5])
+func NewHandler(repo Repository, key []byte, tokenTTL, resetTTL time.Duration) *Handler {
+	return &Handler{Repo: repo, Key: key, TokenTTL: tokenTTL, ResetTTL: resetTTL}
 }
 
 type User struct {
-	Email    string `json:"email"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	ID       int    `json:"-"`
+	Email    string `json:"email" binding:"max=254"`
+	Username string `json:"username" binding:"max=64"`
+	// bcrypt ignores anything past 72 bytes
+	Password string `json:"password" binding:"max=72"`
+	Role     string `json:"-"`
+	Disabled bool   `json:"-"`
+}
+
+// SignUpRequest is a new account's details. The same rules apply wherever an
+// account is created
+type SignUpRequest struct {
+	Username string `json:"username" binding:"required,max=64"`
+	Email    string `json:"email" binding:"required,email,max=254"`
+	// bcrypt ignores anything past 72 bytes
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+// ValidRole reports whether role is one the API understands
+func ValidRole(role string) bool {
+	return role == "user" || role == "admin"
 }
 
 // jwt claims
@@ -35,148 +57,119 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-func SignUp(c *gin.Context) {
-	var newUser User
-	if err := c.BindJSON(&newUser); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
-		return
-	}
-
-	// check if user exists
-
-	var exists int
-	err := db.DB.QueryRow("SELECT COUNT(*) FROM users WHERE username = $1 OR email = $2", newUser.Username, newUser.Email).Scan(&exists)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
-		return
-	}
-
-	if exists > 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user already exists"})
+func (h *Handler) SignUp(c *gin.Context) {
+	var body SignUpRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		apierror.Abort(c, apierror.Bind(err))
 		return
 	}
 
-	// hash the password
-	hashed, err := bcrypt.GenerateFromPassword([]byte(newUser.Password), bcrypt.DefaultCost)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not hash password"})
+	err := CreateAccount(c.Request.Context(), h.Repo, User{Username: body.Username, Email: body.Email, Password: body.Password, Role: "user"})
+	if errors.Is(err, ErrUserExists) {
+		apierror.Abort(c, apierror.New(http.StatusConflict, apierror.CodeAlreadyExists, "user already exists"))
 		return
-	}
-
-	// insert new user
-	_, err = db.DB.Exec("INSERT INTO users(email, username, password) VALUES($1, $2, $3)", newUser.Email, newUser.Username, string(hashed))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create user"})
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("could not create user", err))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "user created succesfully"})
 }
 
-func Login(c *gin.Context) {
+func (h *Handler) Login(c *gin.Context) {
 	var creds User
 
-	if err := c.BindJSON(&creds); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+	if err := c.ShouldBindJSON(&creds); err != nil {
+		apierror.Abort(c, apierror.Bind(err))
 		return
 	}
 
-	var storedHashPassword string
-	var actualUsername string
-	var storedEmail string
-
 	identifier := creds.Username
 	if identifier == "" {
 		identifier = creds.Email
 	}
 
-	err := db.DB.QueryRow("SELECT username, email, password FROM users WHERE username = $1 OR email = $2", identifier, identifier).Scan(&actualUsername, &storedEmail, &storedHashPassword)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid username/email or password"})
+	user, err := h.Repo.FindUserByLogin(c.Request.Context(), identifier)
+	if errors.Is(err, db.ErrNotFound) {
+		metrics.Logins.WithLabelValues("invalid").Inc()
+		apierror.Abort(c, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredentials, "invalid username/email or password"))
 		return
 	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		apierror.Abort(c, apierror.Internal("database error", err))
 		return
 	}
 
 	// verify hashed password
-	err = bcrypt.CompareHashAndPassword([]byte(storedHashPassword), []byte(creds.Password))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid username/email or password"})
+	if !checkPassword(c.Request.Context(), user.Password, creds.Password) {
+		metrics.Logins.WithLabelValues("invalid").Inc()
+		apierror.Abort(c, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidCredentials, "invalid username/email or password"))
 		return
 	}
 
-	expirationTime := time.Now().Add(24 * time.Hour)
+	// only told after the password matched so it doesn't reveal accounts
+	if user.Disabled {
+		metrics.Logins.WithLabelValues("disabled").Inc()
+		apierror.Abort(c, apierror.New(http.StatusForbidden, apierror.CodeAccountDisabled, "account disabled"))
+		return
+	}
+
+	expirationTime := time.Now().Add(h.TokenTTL)
 
 	claims := &Claims{
-		Username: actualUsername,
+		Username: user.Username,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenStr, err := token.SignedString(JwtKey)
+	tokenStr, err := token.SignedString(h.Key)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "could not create token"})
+		apierror.Abort(c, apierror.Internal("could not create token", err))
 		return
 	}
 
+	metrics.Logins.WithLabelValues("success").Inc()
 	c.JSON(http.StatusOK, gin.H{"token": tokenStr})
 }
 
-func DeleteAccount(c *gin.Context) {
-	tokenStr := c.GetHeader("Authorization")
-	if tokenStr == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
-		c.Abort()
-		return
-	}
-
-	if len(tokenStr) > 7 && tokenStr[:7] == "Bearer " {
-		tokenStr = tokenStr[7:]
-	}
-
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return JwtKey, nil
-	})
-
-	if err != nil || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-		c.Abort()
-		return
-	}
-
-	username := claims.Username
+func (h *Handler) DeleteAccount(c *gin.Context) {
+	username := c.GetString("username")
 
-	_, err = db.DB.Exec("DELETE FROM users WHERE username = ?", username)
+	err := h.Repo.DeleteUser(c.Request.Context(), username)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not delete account"})
+		apierror.Abort(c, apierror.Internal("could not delete account", err))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "account deleted successfully"})
 }
 
-func ForgotPassword(c *gin.Context) {
-	var body struct {
-		Email string `json:"email"`
-	}
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token string `json:"token" binding:"required"`
+	// the same rules as SignUpRequest.Password
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
 
-	if err := c.BindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var body ForgotPasswordRequest
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		apierror.Abort(c, apierror.Bind(err))
 		return
 	}
 
-	var exists int
-	err := db.DB.QueryRow("SELECT COUNT(*) FROM users WHERE email = $1", body.Email).Scan(&exists)
+	exists, err := h.Repo.EmailExists(c.Request.Context(), body.Email)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		apierror.Abort(c, apierror.Internal("database error", err))
 		return
 	}
 
-	if exists == 0 {
+	if !exists {
 		c.JSON(http.StatusOK, gin.H{"message": "If this email exists, a reset link was sent"})
 		return
 	}
@@ -187,12 +180,17 @@ func ForgotPassword(c *gin.Context) {
 	token := hex.EncodeToString(tokenBytes)
 
 	// hash token for storage
-	hash, _ := bcrypt.GenerateFromPassword([]byte(token), bcrypt.DefaultCost)
+	hash, _ := HashPassword(c.Request.Context(), token)
 
-	expiresAt := time.Now().Add(15 * time.Minute).Unix()
+	expiresAt := time.Now().Add(h.ResetTTL).Unix()
 
 	// store token
-	db.DB.Exec("INSERT INTO password_resets(email, token_hash, expires_at) VALUES($1, $2, $3)", body.Email, string(hash), expiresAt)
+	err = h.Repo.CreateReset(c.Request.Context(), PasswordReset{Email: body.Email, TokenHash: hash, ExpiresAt: expiresAt})
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("could not create reset link", err))
+		return
+	}
+	metrics.ResetEmails.Inc()
 
 	// send token for testing
 	c.JSON(http.StatusOK, gin.H{
@@ -201,62 +199,49 @@ func ForgotPassword(c *gin.Context) {
 	})
 }
 
-func ResetPassword(c *gin.Context) {
-	var body struct {
-		Token    string `json:"token"`
-		Password string `json:"password"`
-	}
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var body ResetPasswordRequest
 
-	if err := c.BindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "bad request"})
+	if err := c.ShouldBindJSON(&body); err != nil {
+		apierror.Abort(c, apierror.Bind(err))
 		return
 	}
 
-	rows, err := db.DB.Query("SELECT email, token_hash, expires_at FROM password_resets")
+	resets, err := h.Repo.ListResets(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		apierror.Abort(c, apierror.Internal("database error", err))
 		return
 	}
-	defer rows.Close()
-
-	var email string
-	var tokenHash string
-	var expiresAt int64
-	found := false
-
-	for rows.Next() {
-		rows.Scan(&email, &tokenHash, &expiresAt)
 
-		if bcrypt.CompareHashAndPassword([]byte(tokenHash), []byte(body.Token)) == nil {
-			found = true
+	var match *PasswordReset
+	for i := range resets {
+		if checkPassword(c.Request.Context(), resets[i].TokenHash, body.Token) {
+			match = &resets[i]
 			break
 		}
 	}
 
-	if !found || expiresAt < time.Now().Unix() {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired token"})
+	if match == nil || match.ExpiresAt < time.Now().Unix() {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, apierror.CodeInvalidResetToken, "invalid or expired token"))
 		return
 	}
 
-	newHash, _ := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	newHash, _ := HashPassword(c.Request.Context(), body.Password)
 
-	_, err = db.DB.Exec("UPDATE users SET password = $1 WHERE email = $2", string(newHash), email)
+	// update the password and delete the used token together
+	err = h.Repo.ResetPassword(c.Request.Context(), match.Email, newHash)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update password"})
+		apierror.Abort(c, apierror.Internal("could not update password", err))
 		return
 	}
 
-	// delete used token
-	db.DB.Exec("DELETE FROM password_resets WHERE email = $1", email)
-
 	c.JSON(http.StatusOK, gin.H{"message": "password reset successful"})
 }
 
-func RequireAuth(c *gin.Context) {
+func (h *Handler) RequireAuth(c *gin.Context) {
 	tokenStr := c.GetHeader("Authorization")
 	if tokenStr == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
-		c.Abort()
+		apierror.Abort(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "missing token"))
 		return
 	}
 
@@ -266,55 +251,54 @@ func RequireAuth(c *gin.Context) {
 
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return JwtKey, nil
+		return h.Key, nil
 	})
 
 	if err != nil || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-		c.Abort()
+		apierror.Abort(c, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidToken, "invalid token"))
 		return
 	}
 
-	c.Set("username", claims.Username)
-
-	var email string
-	err = db.DB.QueryRow("SELECT email FROM users WHERE username = $1", claims.Username).Scan(&email)
-	if err == nil {
-		c.Set("email", email)
+	user, err := h.Repo.FindUserByUsername(c.Request.Context(), claims.Username)
+	if errors.Is(err, db.ErrNotFound) {
+		apierror.Abort(c, apierror.New(http.StatusUnauthorized, apierror.CodeInvalidToken, "user no longer exists"))
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("database error", err))
+		return
 	}
 
-	var role string
-	err = db.DB.QueryRow("SELECT role FROM users WHERE username = $1", claims.Username).Scan(&role)
-	if err == nil {
-		c.Set("role", role)
+	if user.Disabled {
+		apierror.Abort(c, apierror.New(http.StatusForbidden, apierror.CodeAccountDisabled, "account disabled"))
+		return
 	}
 
-	log.Println("Authorization header:", c.GetHeader("Authorization"))
-	log.Println("Claims from JWT:", claims.Username)
-	roleStr, _ := c.Get("role")
-	log.Println("Role from DB:", roleStr)
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	c.Set("email", user.Email)
+	c.Set("role", user.Role)
+
+	slog.DebugContext(c.Request.Context(), "authenticated request", "user_id", user.ID, "role", user.Role)
 
 	c.Next()
 }
 
-func RequireAdmin(c *gin.Context) {
+func (h *Handler) RequireAdmin(c *gin.Context) {
 	role, exists := c.Get("role")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-		c.Abort()
+		apierror.Abort(c, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "unauthorized"))
 		return
 	}
 
 	if roleStr, ok := role.(string); !ok || roleStr != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "admin only"})
-		c.Abort()
+		apierror.Abort(c, apierror.New(http.StatusForbidden, apierror.CodeForbidden, "admin only"))
 		return
 	}
 
 	c.Next()
 }
 
-func Me(c *gin.Context) {
+func (h *Handler) Me(c *gin.Context) {
 	username := c.GetString("username")
 	email := c.GetString("email")
 
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/z-sk1/signin-api/internal/apierror"
+	"github.com/z-sk1/signin-api/internal/validation"
+)
+
+var (
+	// ErrAdminExists is returned when bootstrapping an instance that already has an admin
+	ErrAdminExists = errors.New("an admin account already exists")
+	ErrUserExists  = errors.New("user already exists")
+	// ErrInvalidAccount wraps the rules an account's details break
+	ErrInvalidAccount = errors.New("invalid account")
+)
+
+// CreateAccount hashes user's plain-text password and stores the account,
+// failing when the username or email is taken. The details must follow the
+// rules of SignUpRequest, wherever they came from
+func CreateAccount(ctx context.Context, repo Repository, user User) error {
+	if err := validateAccount(user); err != nil {
+		return err
+	}
+
+	exists, err := repo.UserExists(ctx, user.Username, user.Email)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrUserExists
+	}
+
+	user.Password, err = HashPassword(ctx, user.Password)
+	if err != nil {
+		return err
+	}
+
+	return repo.CreateUser(ctx, &user)
+}
+
+func validateAccount(user User) error {
+	if user.Role != "" && !ValidRole(user.Role) {
+		return fmt.Errorf("%w: role must be user or admin", ErrInvalidAccount)
+	}
+
+	validation.Register()
+	return invalidAccount(binding.Validator.ValidateStruct(SignUpRequest{Username: user.Username, Email: user.Email, Password: user.Password}))
+}
+
+// ValidatePassword checks a plain-text password against the rules of
+// SignUpRequest, for passwords set outside a request
+func ValidatePassword(password string) error {
+	validation.Register()
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return nil
+	}
+	return invalidAccount(v.StructPartial(SignUpRequest{Password: password}, "Password"))
+}
+
+// invalidAccount words a validation error as ErrInvalidAccount
+func invalidAccount(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	apiErr := apierror.Bind(err)
+	if len(apiErr.Fields) == 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidAccount, err)
+	}
+	problems := make([]string, len(apiErr.Fields))
+	for i, f := range apiErr.Fields {
+		problems[i] = f.Field + " " + f.Message
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidAccount, strings.Join(problems, ", "))
+}
+
+// CreateFirstAdmin creates user as an admin, but only while no admin exists
+// yet. The password is given in plain text and hashed here
+func CreateFirstAdmin(ctx context.Context, repo Repository, user User) error {
+	exists, err := repo.AdminExists(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrAdminExists
+	}
+
+	user.Role = "admin"
+	return CreateAccount(ctx, repo, user)
+}
+
+// NewSetupToken returns a random token for SetupHandler
+func NewSetupToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// SetupHandler lets whoever holds the one-time token printed at startup
+// create the first admin on a fresh instance
+type SetupHandler struct {
+	Repo Repository
+
+	mu    sync.Mutex
+	token string // cleared once used
+}
+
+// NewSetupHandler returns a handler accepting token; an empty token disables setup
+func NewSetupHandler(repo Repository, token string) *SetupHandler {
+	return &SetupHandler{Repo: repo, token: token}
+}
+
+// SetupRequest creates the first admin using the token printed at startup
+type SetupRequest struct {
+	Token    string `json:"token"`
+	Username string `json:"username" binding:"required,max=64"`
+	Email    string `json:"email" binding:"required,email,max=254"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+func (h *SetupHandler) Setup(c *gin.Context) {
+	var body SetupRequest
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		apierror.Abort(c, apierror.Bind(err))
+		return
+	}
+
+	// one setup at a time so the token can't be used twice
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.token == "" {
+		apierror.Abort(c, apierror.New(http.StatusGone, apierror.CodeSetupUnavailable, "setup is not available"))
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(body.Token), []byte(h.token)) != 1 {
+		apierror.Abort(c, apierror.New(http.StatusForbidden, apierror.CodeInvalidSetupToken, "invalid setup token"))
+		return
+	}
+
+	err := CreateFirstAdmin(c.Request.Context(), h.Repo, User{Username: body.Username, Email: body.Email, Password: body.Password})
+	switch {
+	case errors.Is(err, ErrAdminExists):
+		h.token = ""
+		apierror.Abort(c, apierror.New(http.StatusGone, apierror.CodeSetupUnavailable, "setup is not available"))
+		return
+	case errors.Is(err, ErrUserExists):
+		apierror.Abort(c, apierror.New(http.StatusConflict, apierror.CodeAlreadyExists, err.Error()))
+		return
+	case errors.Is(err, ErrInvalidAccount):
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, err.Error()))
+		return
+	case err != nil:
+		apierror.Abort(c, apierror.Internal("could not create admin", err))
+		return
+	}
+
+	h.token = ""
+	c.JSON(http.StatusOK, gin.H{"message": "admin created successfully"})
+}
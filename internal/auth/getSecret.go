@@ -6,8 +6,9 @@ import (
 	"os"
 )
 
-func getOrCreateSecret() []byte {
-	data, err := os.ReadFile("secret.txt")
+// LoadOrCreateSecret returns the JWT signing key from path, creating it on first run
+func LoadOrCreateSecret(path string) []byte {
+	data, err := os.ReadFile(path)
 	if err == nil {
 		return data
 	}
@@ -16,6 +17,6 @@ func getOrCreateSecret() []byte {
 	b := make([]byte, 32)
 	rand.Read(b)
 	hexSecret := hex.EncodeToString(b)
-	os.WriteFile("secret.txt", []byte(hexSecret), 0600)
+	os.WriteFile(path, []byte(hexSecret), 0600)
 	return []byte(hexSecret)
 }
@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/z-sk1/signin-api/internal/db"
+)
+
+var errDuplicateUser = errors.New("username or email already taken")
+
+type memoryRepository struct {
+	mu     sync.Mutex
+	nextID int
+	users  []User
+	resets []PasswordReset
+}
+
+// NewMemoryRepository returns a Repository backed by process memory, used in tests
+func NewMemoryRepository() Repository {
+	return &memoryRepository{nextID: 1}
+}
+
+func (r *memoryRepository) UserExists(ctx context.Context, username, email string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.Username == username || u.Email == email {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.Email == email {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryRepository) AdminExists(ctx context.Context) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.Role == "admin" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryRepository) CreateUser(ctx context.Context, user *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if u.Username == user.Username || u.Email == user.Email {
+			return errDuplicateUser
+		}
+	}
+
+	if user.Role == "" {
+		user.Role = "user"
+	}
+	user.ID = r.nextID
+	r.nextID++
+	r.users = append(r.users, *user)
+
+	return nil
+}
+
+func (r *memoryRepository) find(match func(u *User) bool) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.users {
+		if match(&r.users[i]) {
+			user := r.users[i]
+			return &user, nil
+		}
+	}
+	return nil, db.ErrNotFound
+}
+
+func (r *memoryRepository) FindUserByLogin(ctx context.Context, identifier string) (*User, error) {
+	return r.find(func(u *User) bool {
+		return u.Username == identifier || u.Email == identifier
+	})
+}
+
+func (r *memoryRepository) FindUserByUsername(ctx context.Context, username string) (*User, error) {
+	return r.find(func(u *User) bool {
+		return u.Username == username
+	})
+}
+
+// update applies change to the named user
+func (r *memoryRepository) update(username string, change func(u *User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.users {
+		if r.users[i].Username == username {
+			change(&r.users[i])
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
+
+func (r *memoryRepository) SetRole(ctx context.Context, username, role string) error {
+	return r.update(username, func(u *User) { u.Role = role })
+}
+
+func (r *memoryRepository) SetDisabled(ctx context.Context, username string, disabled bool) error {
+	return r.update(username, func(u *User) { u.Disabled = disabled })
+}
+
+func (r *memoryRepository) DeleteUser(ctx context.Context, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.users {
+		if r.users[i].Username == username {
+			r.users = append(r.users[:i], r.users[i+1:]...)
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
+
+func (r *memoryRepository) CreateReset(ctx context.Context, reset PasswordReset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.resets = append(r.resets, reset)
+	return nil
+}
+
+func (r *memoryRepository) ListResets(ctx context.Context) ([]PasswordReset, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]PasswordReset(nil), r.resets...), nil
+}
+
+func (r *memoryRepository) ResetPassword(ctx context.Context, email, passwordHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	found := false
+	for i := range r.users {
+		if r.users[i].Email == email {
+			r.users[i].Password = passwordHash
+			found = true
+		}
+	}
+	if !found {
+		return db.ErrNotFound
+	}
+
+	kept := r.resets[:0]
+	for _, reset := range r.resets {
+		if reset.Email != email {
+			kept = append(kept, reset)
+		}
+	}
+	r.resets = kept
+
+	return nil
+}
+
+func (r *memoryRepository) PurgeExpiredResets(ctx context.Context, before int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	kept := r.resets[:0]
+	for _, reset := range r.resets {
+		if reset.ExpiresAt < before {
+			purged++
+			continue
+		}
+		kept = append(kept, reset)
+	}
+	r.resets = kept
+
+	return purged, nil
+}
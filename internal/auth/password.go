@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var tracer = otel.Tracer("github.com/z-sk1/signin-api/internal/auth")
+
+// HashPassword returns the bcrypt hash stored for password. bcrypt is slow on
+// purpose, so it gets its own span to tell it apart from database time
+func HashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracer.Start(ctx, "bcrypt hash")
+	defer span.End()
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hashed), err
+}
+
+// checkPassword reports whether password matches the stored hash
+func checkPassword(ctx context.Context, hash, password string) bool {
+	_, span := tracer.Start(ctx, "bcrypt compare")
+	defer span.End()
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
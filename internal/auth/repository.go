@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/z-sk1/signin-api/internal/db"
+)
+
+type PasswordReset struct {
+	Email     string
+	TokenHash string
+	ExpiresAt int64
+}
+
+// Repository stores user accounts and pending password resets
+type Repository interface {
+	UserExists(ctx context.Context, username, email string) (bool, error)
+	EmailExists(ctx context.Context, email string) (bool, error)
+	AdminExists(ctx context.Context) (bool, error)
+	CreateUser(ctx context.Context, user *User) error
+	// FindUserByLogin looks a user up by username or email
+	FindUserByLogin(ctx context.Context, identifier string) (*User, error)
+	FindUserByUsername(ctx context.Context, username string) (*User, error)
+	SetRole(ctx context.Context, username, role string) error
+	// SetDisabled blocks or unblocks logins and existing tokens for the account
+	SetDisabled(ctx context.Context, username string, disabled bool) error
+	// DeleteUser removes the account together with everything it owns
+	DeleteUser(ctx context.Context, username string) error
+
+	CreateReset(ctx context.Context, reset PasswordReset) error
+	ListResets(ctx context.Context) ([]PasswordReset, error)
+	// ResetPassword sets a new password hash and drops the email's pending
+	// resets in one step, so a used token can never be replayed
+	ResetPassword(ctx context.Context, email, passwordHash string) error
+	// PurgeExpiredResets deletes resets that expired before the unix time and
+	// returns how many were removed
+	PurgeExpiredResets(ctx context.Context, before int64) (int64, error)
+}
+
+type sqlRepository struct {
+	conn *db.Conn
+}
+
+func NewSQLRepository(conn *db.Conn) Repository {
+	return &sqlRepository{conn: conn}
+}
+
+func (r *sqlRepository) UserExists(ctx context.Context, username, email string) (bool, error) {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := r.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE username = $1 OR email = $2", username, email).Scan(&count)
+	return count > 0, err
+}
+
+func (r *sqlRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := r.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE email = $1", email).Scan(&count)
+	return count > 0, err
+}
+
+func (r *sqlRepository) AdminExists(ctx context.Context) (bool, error) {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := r.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE role = 'admin'").Scan(&count)
+	return count > 0, err
+}
+
+func (r *sqlRepository) CreateUser(ctx context.Context, user *User) error {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	role := user.Role
+	if role == "" {
+		role = "user"
+	}
+
+	err := r.conn.QueryRowContext(ctx,
+		"INSERT INTO users(email, username, password, role) VALUES($1, $2, $3, $4) RETURNING id",
+		user.Email, user.Username, user.Password, role,
+	).Scan(&user.ID)
+	if err != nil {
+		return err
+	}
+
+	user.Role = role
+	return nil
+}
+
+func (r *sqlRepository) findUser(ctx context.Context, where string, arg string) (*User, error) {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	var user User
+	err := r.conn.QueryRowContext(ctx, "SELECT id, email, username, password, role, disabled FROM users WHERE "+where, arg).
+		Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Role, &user.Disabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, db.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (r *sqlRepository) FindUserByLogin(ctx context.Context, identifier string) (*User, error) {
+	return r.findUser(ctx, "username = $1 OR email = $1", identifier)
+}
+
+func (r *sqlRepository) FindUserByUsername(ctx context.Context, username string) (*User, error) {
+	return r.findUser(ctx, "username = $1", username)
+}
+
+func (r *sqlRepository) SetRole(ctx context.Context, username, role string) error {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	res, err := r.conn.ExecContext(ctx, "UPDATE users SET role = $1 WHERE username = $2", role, username)
+	if err != nil {
+		return err
+	}
+
+	return db.RequireRows(res)
+}
+
+func (r *sqlRepository) SetDisabled(ctx context.Context, username string, disabled bool) error {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	res, err := r.conn.ExecContext(ctx, "UPDATE users SET disabled = $1 WHERE username = $2", disabled, username)
+	if err != nil {
+		return err
+	}
+
+	return db.RequireRows(res)
+}
+
+func (r *sqlRepository) DeleteUser(ctx context.Context, username string) error {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	return r.conn.WithTx(ctx, func(tx *db.Tx) error {
+		var id int
+		var email string
+		err := tx.QueryRowContext(ctx, "SELECT id, email FROM users WHERE username = $1", username).Scan(&id, &email)
+		if errors.Is(err, sql.ErrNoRows) {
+			return db.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		// children first so the foreign keys on users(id) are satisfied
+		for _, table := range []string{"notes", "reminders", "expenses", "leaderboard", "idempotency_keys"} {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE user_id = $1", id); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM password_resets WHERE email = $1", email); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", id)
+		return err
+	})
+}
+
+func (r *sqlRepository) CreateReset(ctx context.Context, reset PasswordReset) error {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.conn.ExecContext(ctx, "INSERT INTO password_resets(email, token_hash, expires_at) VALUES($1, $2, $3)", reset.Email, reset.TokenHash, reset.ExpiresAt)
+	return err
+}
+
+func (r *sqlRepository) ListResets(ctx context.Context) ([]PasswordReset, error) {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.conn.QueryContext(ctx, "SELECT email, token_hash, expires_at FROM password_resets")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var resets []PasswordReset
+	for rows.Next() {
+		var reset PasswordReset
+		if err := rows.Scan(&reset.Email, &reset.TokenHash, &reset.ExpiresAt); err != nil {
+			return nil, err
+		}
+		resets = append(resets, reset)
+	}
+
+	return resets, rows.Err()
+}
+
+func (r *sqlRepository) ResetPassword(ctx context.Context, email, passwordHash string) error {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	return r.conn.WithTx(ctx, func(tx *db.Tx) error {
+		res, err := tx.ExecContext(ctx, "UPDATE users SET password = $1 WHERE email = $2", passwordHash, email)
+		if err != nil {
+			return err
+		}
+		if err := db.RequireRows(res); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM password_resets WHERE email = $1", email)
+		return err
+	})
+}
+
+func (r *sqlRepository) PurgeExpiredResets(ctx context.Context, before int64) (int64, error) {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	res, err := r.conn.ExecContext(ctx, "DELETE FROM password_resets WHERE expires_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
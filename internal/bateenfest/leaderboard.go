@@ -1,118 +1,115 @@
 package leaderboard
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/z-sk1/signin-api/internal/apierror"
 	"github.com/z-sk1/signin-api/internal/db"
+	"github.com/z-sk1/signin-api/internal/listquery"
 )
 
-type LeaderboardEntry struct {
-	ID      int    `json:"id"`
-	Section string `json:"section"`
-	Name    string `json:"name"`
-	Points  int    `json:"points"`
-	Rank    int    `json:"rank"`
+type Handler struct {
+	Repo Repository
 }
 
-func AddLeaderboardScore(c *gin.Context) {
-	var entry LeaderboardEntry
+func NewHandler(repo Repository) *Handler {
+	return &Handler{Repo: repo}
+}
 
-	if err := c.BindJSON(&entry); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
-		return
-	}
+type LeaderboardEntry struct {
+	ID       int    `json:"id" openapi:"readonly"`
+	UserID   int    `json:"-"`
+	Username string `json:"-"`
+	Section  string `json:"section" binding:"required,max=50"`
+	Name     string `json:"name" binding:"required,max=100"`
+	Points   int    `json:"points" binding:"gte=0,max=1000000"`
+	// Rank is the entry's place in the list as sorted, counted across pages
+	Rank int `json:"rank" openapi:"readonly"`
+}
 
-	if entry.Points < 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "points must be positive"})
-		return
-	}
+func (h *Handler) AddLeaderboardScore(c *gin.Context) {
+	var entry LeaderboardEntry
 
-	username := c.GetString("username")
-	var userID int
-	err := db.DB.QueryRow("SELECT id FROM users WHERE username = $1", username).Scan(&userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not find user"})
+	if err := c.ShouldBindJSON(&entry); err != nil {
+		apierror.Abort(c, apierror.Bind(err))
 		return
 	}
 
-	_, err = db.DB.Exec(`
-		INSERT INTO leaderboard (user_id, username, section, name, points)
-		VALUES ($1, $2, $3, $4, $5)
-	`, userID, username, entry.Section, entry.Name, entry.Points)
+	entry.UserID = c.GetInt("user_id")
+	entry.Username = c.GetString("username")
 
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add score"})
+	if err := h.Repo.Add(c.Request.Context(), &entry); err != nil {
+		apierror.Abort(c, apierror.Internal("failed to add score", err))
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{"message": "score added"})
 }
 
-func GetAllLeaderboardScores(c *gin.Context) {
-	section := c.Param("section")
-
-	rows, err := db.DB.Query(`
-		SELECT id, name, points
-		FROM leaderboard
-		WHERE section = $1
-		ORDER BY points DESC
-	`, section)
+func (h *Handler) GetAllLeaderboardScores(c *gin.Context) {
+	q, apiErr := ListSpec.Parse(c.Request.URL.Query())
+	if apiErr != nil {
+		apierror.Abort(c, apiErr)
+		return
+	}
 
+	page, err := h.Repo.List(c.Request.Context(), c.Param("section"), q)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch leaderboard"})
+		apierror.Abort(c, apierror.Internal("failed to fetch leaderboard", err))
 		return
 	}
-	defer rows.Close()
-
-	var entries []LeaderboardEntry
-	rank := 1
 
-	for rows.Next() {
-		var entry LeaderboardEntry
-		rows.Scan(&entry.ID, &entry.Name, &entry.Points)
-		entry.Rank = rank
-		rank++
-		entries = append(entries, entry)
+	// ranks carry on from the earlier pages
+	for i := range page.Items {
+		page.Items[i].Rank = q.Offset() + i + 1
 	}
 
-	c.JSON(http.StatusOK, entries)
+	listquery.Write(c, "entries", page)
 }
 
-func DeleteLeaderboardScore(c *gin.Context) {
-	id := c.Param("id")
-
-	_, err := db.DB.Exec("DELETE FROM leaderboard WHERE id = $1", id)
+func (h *Handler) DeleteLeaderboardScore(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete score"})
+		apierror.Abort(c, apierror.InvalidField("id", "invalid", "invalid score id"))
+		return
+	}
+
+	err = h.Repo.Delete(c.Request.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		apierror.Abort(c, apierror.NotFound("score not found"))
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("failed to delete score", err))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "score deleted"})
 }
 
-func UpdateLeaderboardScore(c *gin.Context) {
-	id := c.Param("id")
-
-	var entry struct {
-		Section string `json:"section"`
-		Name    string `json:"name"`
-		Points  int    `json:"points"`
+func (h *Handler) UpdateLeaderboardScore(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, apierror.InvalidField("id", "invalid", "invalid score id"))
+		return
 	}
 
-	if err := c.BindJSON(&entry); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+	var entry LeaderboardEntry
+	if err := c.ShouldBindJSON(&entry); err != nil {
+		apierror.Abort(c, apierror.Bind(err))
 		return
 	}
 
-	_, err := db.DB.Exec(`
-		UPDATE leaderboard
-		SET section = $1, name = $2, points = $3
-		WHERE id = $4
-	`, entry.Section, entry.Name, entry.Points, id)
+	entry.ID = id
 
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update score"})
+	err = h.Repo.Update(c.Request.Context(), &entry)
+	if errors.Is(err, db.ErrNotFound) {
+		apierror.Abort(c, apierror.NotFound("score not found"))
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("failed to update score", err))
 		return
 	}
 
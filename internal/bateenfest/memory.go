@@ -0,0 +1,87 @@
+package leaderboard
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/z-sk1/signin-api/internal/db"
+	"github.com/z-sk1/signin-api/internal/listquery"
+)
+
+type memoryRepository struct {
+	mu      sync.Mutex
+	nextID  int
+	entries []LeaderboardEntry
+}
+
+// NewMemoryRepository returns a Repository backed by process memory, used in tests
+func NewMemoryRepository() Repository {
+	return &memoryRepository{nextID: 1}
+}
+
+func (r *memoryRepository) Add(ctx context.Context, entry *LeaderboardEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry.ID = r.nextID
+	r.nextID++
+	r.entries = append(r.entries, *entry)
+
+	return nil
+}
+
+func (r *memoryRepository) List(ctx context.Context, section string, q listquery.Query) (listquery.Page[LeaderboardEntry], error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var entries []LeaderboardEntry
+	for _, entry := range r.entries {
+		if entry.Section == section {
+			entries = append(entries, entry)
+		}
+	}
+	return listquery.Apply(q, entries, field), nil
+}
+
+func (r *memoryRepository) ListAll(ctx context.Context) ([]LeaderboardEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := append([]LeaderboardEntry(nil), r.entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Section != entries[j].Section {
+			return entries[i].Section < entries[j].Section
+		}
+		return entries[i].Points > entries[j].Points
+	})
+	return entries, nil
+}
+
+func (r *memoryRepository) Update(ctx context.Context, entry *LeaderboardEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.entries {
+		if r.entries[i].ID == entry.ID {
+			r.entries[i].Section = entry.Section
+			r.entries[i].Name = entry.Name
+			r.entries[i].Points = entry.Points
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
+
+func (r *memoryRepository) Delete(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.entries {
+		if r.entries[i].ID == id {
+			r.entries = append(r.entries[:i], r.entries[i+1:]...)
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
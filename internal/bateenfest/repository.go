@@ -0,0 +1,139 @@
+package leaderboard
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/z-sk1/signin-api/internal/db"
+	"github.com/z-sk1/signin-api/internal/listquery"
+)
+
+// Repository stores leaderboard entries grouped by section
+type Repository interface {
+	Add(ctx context.Context, entry *LeaderboardEntry) error
+	// List returns a page of a section's entries, by default ordered by
+	// points, highest first
+	List(ctx context.Context, section string, q listquery.Query) (listquery.Page[LeaderboardEntry], error)
+	// ListAll returns every entry ordered by section, then points
+	ListAll(ctx context.Context) ([]LeaderboardEntry, error)
+	Update(ctx context.Context, entry *LeaderboardEntry) error
+	Delete(ctx context.Context, id int) error
+}
+
+// ListSpec is how a section's entries can be sorted
+var ListSpec = listquery.Spec{
+	Fields:      []listquery.Field{{Name: "points", Column: "points", Kind: listquery.Int, Sort: true}},
+	DefaultSort: "-points",
+}
+
+// field is the listquery.Accessor for entries
+func field(entry LeaderboardEntry, name string) any {
+	if name == "points" {
+		return entry.Points
+	}
+	return entry.ID
+}
+
+type sqlRepository struct {
+	conn *db.Conn
+}
+
+func NewSQLRepository(conn *db.Conn) Repository {
+	return &sqlRepository{conn: conn}
+}
+
+func (r *sqlRepository) Add(ctx context.Context, entry *LeaderboardEntry) error {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	return r.conn.Using(ctx).QueryRowContext(ctx, `
+		INSERT INTO leaderboard (user_id, username, section, name, points)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, entry.UserID, entry.Username, entry.Section, entry.Name, entry.Points).Scan(&entry.ID)
+}
+
+func (r *sqlRepository) List(ctx context.Context, section string, q listquery.Query) (listquery.Page[LeaderboardEntry], error) {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	var total int
+	if err := r.conn.Using(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM leaderboard WHERE section = $1", section).Scan(&total); err != nil {
+		return listquery.Page[LeaderboardEntry]{}, err
+	}
+
+	conds, args := q.Seek([]string{"section = $1"}, []any{section})
+	rows, err := r.conn.Using(ctx).QueryContext(ctx,
+		"SELECT id, user_id, section, name, points FROM leaderboard WHERE "+strings.Join(conds, " AND ")+" ORDER BY "+q.OrderBy()+q.LimitClause(),
+		args...,
+	)
+	if err != nil {
+		return listquery.Page[LeaderboardEntry]{}, err
+	}
+
+	entries, err := scanEntries(rows)
+	if err != nil {
+		return listquery.Page[LeaderboardEntry]{}, err
+	}
+	return listquery.Finish(q, entries, total, field), nil
+}
+
+func (r *sqlRepository) ListAll(ctx context.Context) ([]LeaderboardEntry, error) {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.conn.Using(ctx).QueryContext(ctx, `
+		SELECT id, user_id, section, name, points
+		FROM leaderboard
+		ORDER BY section, points DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanEntries(rows)
+}
+
+func scanEntries(rows *sql.Rows) ([]LeaderboardEntry, error) {
+	defer rows.Close()
+
+	var entries []LeaderboardEntry
+	for rows.Next() {
+		var entry LeaderboardEntry
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Section, &entry.Name, &entry.Points); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (r *sqlRepository) Update(ctx context.Context, entry *LeaderboardEntry) error {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	res, err := r.conn.Using(ctx).ExecContext(ctx, `
+		UPDATE leaderboard
+		SET section = $1, name = $2, points = $3
+		WHERE id = $4
+	`, entry.Section, entry.Name, entry.Points, entry.ID)
+	if err != nil {
+		return err
+	}
+
+	return db.RequireRows(res)
+}
+
+func (r *sqlRepository) Delete(ctx context.Context, id int) error {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	res, err := r.conn.Using(ctx).ExecContext(ctx, "DELETE FROM leaderboard WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	return db.RequireRows(res)
+}
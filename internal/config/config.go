@@ -0,0 +1,386 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is every setting the server and the commands read. Each leaf field
+// can come from, in increasing precedence: its default, the JSON config file,
+// the env var named by its env tag, or the command-line flag named by its flag tag
+type Config struct {
+	Server   Server   `json:"server"`
+	Database Database `json:"database"`
+	Auth     Auth     `json:"auth"`
+	Admin    Admin    `json:"admin"`
+	Log      Log      `json:"log"`
+	Tracing  Tracing  `json:"tracing"`
+}
+
+type Server struct {
+	Port               int      `json:"port" env:"PORT" flag:"port" help:"port to listen on"`
+	ReadTimeout        Duration `json:"read_timeout" env:"READ_TIMEOUT" flag:"read-timeout" help:"maximum time to read a whole request"`
+	ReadHeaderTimeout  Duration `json:"read_header_timeout" env:"READ_HEADER_TIMEOUT" flag:"read-header-timeout" help:"maximum time to read request headers"`
+	WriteTimeout       Duration `json:"write_timeout" env:"WRITE_TIMEOUT" flag:"write-timeout" help:"maximum time to write a response"`
+	IdleTimeout        Duration `json:"idle_timeout" env:"IDLE_TIMEOUT" flag:"idle-timeout" help:"how long keep-alive connections stay open"`
+	ShutdownTimeout    Duration `json:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" help:"time allowed for in-flight requests on SIGTERM"`
+	DrainDelay         Duration `json:"drain_delay" env:"DRAIN_DELAY" flag:"drain-delay" help:"time to keep serving with /readyz failing before shutdown"`
+	TLSCertFile        string   `json:"tls_cert_file" env:"TLS_CERT_FILE" flag:"tls-cert" help:"TLS certificate file; enables HTTPS together with -tls-key"`
+	TLSKeyFile         string   `json:"tls_key_file" env:"TLS_KEY_FILE" flag:"tls-key" help:"TLS private key file"`
+	HTTP3              bool     `json:"http3" env:"HTTP3" flag:"http3" help:"also serve HTTP/3 over UDP (requires TLS)"`
+	MaxBodyBytes       int      `json:"max_body_bytes" env:"MAX_BODY_BYTES" flag:"max-body-bytes" help:"largest request body accepted, in bytes"`
+	RequireIfMatch     bool     `json:"require_if_match" env:"REQUIRE_IF_MATCH" flag:"require-if-match" help:"reject writes to notes, reminders and expenses without an If-Match header"`
+	IdempotencyWindow  Duration `json:"idempotency_window" env:"IDEMPOTENCY_WINDOW" flag:"idempotency-window" help:"how long responses to requests with an Idempotency-Key are replayed; 0 disables"`
+	MaxBatchOperations int      `json:"max_batch_operations" env:"MAX_BATCH_OPERATIONS" flag:"max-batch-operations" help:"most operations accepted in one POST /batch"`
+}
+
+type Database struct {
+	Driver       string   `json:"driver" env:"DB_DRIVER" flag:"db-driver" help:"postgres or sqlite"`
+	URL          string   `json:"url" env:"DATABASE_URL" flag:"database-url" secret:"true" help:"postgres connection string, or sqlite file path"`
+	QueryTimeout Duration `json:"query_timeout" env:"QUERY_TIMEOUT" flag:"query-timeout" help:"limit for each database call"`
+}
+
+type Auth struct {
+	SecretFile    string   `json:"secret_file" env:"JWT_SECRET_FILE" flag:"jwt-secret-file" help:"file holding the JWT signing key, created if missing"`
+	TokenTTL      Duration `json:"token_ttl" env:"TOKEN_TTL" flag:"token-ttl" help:"how long login tokens stay valid"`
+	ResetTokenTTL Duration `json:"reset_token_ttl" env:"RESET_TOKEN_TTL" flag:"reset-token-ttl" help:"how long password reset tokens stay valid"`
+}
+
+// Admin optionally seeds the first admin account at startup. When it's left
+// empty and no admin exists, a one-time setup token is logged instead
+type Admin struct {
+	Username     string `json:"username" env:"ADMIN_USERNAME" flag:"admin-username" help:"username of the admin to create if none exists"`
+	Email        string `json:"email" env:"ADMIN_EMAIL" flag:"admin-email" help:"email of the admin to create if none exists"`
+	Password     string `json:"password" env:"ADMIN_PASSWORD" flag:"admin-password" secret:"true" help:"password of the admin to create; prefer -admin-password-file"`
+	PasswordFile string `json:"password_file" env:"ADMIN_PASSWORD_FILE" flag:"admin-password-file" help:"file holding the password of the admin to create"`
+}
+
+// Seeded reports whether an admin account should be created from config
+func (a Admin) Seeded() bool {
+	return a.Username != ""
+}
+
+// LoadPassword returns Password, or the contents of PasswordFile without the
+// trailing newline
+func (a Admin) LoadPassword() (string, error) {
+	if a.PasswordFile == "" {
+		return a.Password, nil
+	}
+
+	data, err := os.ReadFile(a.PasswordFile)
+	if err != nil {
+		return "", fmt.Errorf("read admin password file: %w", err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+type Log struct {
+	Format string `json:"format" env:"LOG_FORMAT" flag:"log-format" help:"text or json"`
+	Level  string `json:"level" env:"LOG_LEVEL" flag:"log-level" help:"debug, info, warn or error"`
+}
+
+type Tracing struct {
+	Exporter    string  `json:"exporter" env:"TRACING_EXPORTER" flag:"tracing-exporter" help:"none, stdout or otlp"`
+	Endpoint    string  `json:"endpoint" env:"TRACING_ENDPOINT" flag:"tracing-endpoint" help:"OTLP/HTTP collector URL; defaults to OTEL_EXPORTER_OTLP_ENDPOINT or http://localhost:4318"`
+	SampleRatio float64 `json:"sample_ratio" env:"TRACING_SAMPLE_RATIO" flag:"tracing-sample-ratio" help:"fraction of new traces recorded, 0 to 1"`
+	ServiceName string  `json:"service_name" env:"OTEL_SERVICE_NAME" flag:"tracing-service-name" help:"service name attached to spans"`
+}
+
+// Duration reads and writes as a Go duration string such as "15s"
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"15s\": %w", err)
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:               8080,
+			ReadTimeout:        Duration{15 * time.Second},
+			ReadHeaderTimeout:  Duration{5 * time.Second},
+			WriteTimeout:       Duration{30 * time.Second},
+			IdleTimeout:        Duration{2 * time.Minute},
+			ShutdownTimeout:    Duration{20 * time.Second},
+			MaxBodyBytes:       1 << 20,
+			IdempotencyWindow:  Duration{24 * time.Hour},
+			MaxBatchOperations: 100,
+		},
+		Database: Database{
+			Driver:       "postgres",
+			QueryTimeout: Duration{5 * time.Second},
+		},
+		Auth: Auth{
+			SecretFile:    "secret.txt",
+			TokenTTL:      Duration{24 * time.Hour},
+			ResetTokenTTL: Duration{15 * time.Minute},
+		},
+		Log: Log{
+			Format: "text",
+			Level:  "info",
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			SampleRatio: 1,
+			ServiceName: "signin-api",
+		},
+	}
+}
+
+// field is one leaf setting found by walking Config
+type field struct {
+	key    string
+	env    string
+	flag   string
+	help   string
+	secret bool
+	value  reflect.Value
+}
+
+func fields(cfg *Config) []field {
+	var out []field
+
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			key := prefix + sf.Tag.Get("json")
+
+			if sf.Type.Kind() == reflect.Struct && sf.Type != reflect.TypeOf(Duration{}) {
+				walk(key+".", v.Field(i))
+				continue
+			}
+
+			out = append(out, field{
+				key:    key,
+				env:    sf.Tag.Get("env"),
+				flag:   sf.Tag.Get("flag"),
+				help:   sf.Tag.Get("help"),
+				secret: sf.Tag.Get("secret") == "true",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk("", reflect.ValueOf(cfg).Elem())
+
+	return out
+}
+
+func (f field) set(raw string) error {
+	switch ptr := f.value.Addr().Interface().(type) {
+	case *string:
+		*ptr = raw
+	case *int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		*ptr = n
+	case *float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		*ptr = n
+	case *bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		*ptr = b
+	case *Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		ptr.Duration = d
+	default:
+		return fmt.Errorf("unsupported config type %s", f.value.Type())
+	}
+	return nil
+}
+
+// rawFlag holds a flag's text until the file and env have been applied
+type rawFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *rawFlag) String() string     { return f.value }
+func (f *rawFlag) Set(s string) error { f.value = s; return nil }
+func (f *rawFlag) IsBoolFlag() bool   { return f.isBool }
+
+// Load builds the effective config from defaults, the file named by -config
+// or CONFIG_FILE, the environment and args. It returns the arguments left
+// after the flags, which name the command to run. Callers run Validate
+// themselves so commands like help work on an incomplete config
+func Load(args []string, usage io.Writer) (*Config, []string, error) {
+	cfg := Default()
+	all := fields(cfg)
+
+	fs := flag.NewFlagSet("signin-api", flag.ContinueOnError)
+	fs.SetOutput(usage)
+
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "JSON config file (env CONFIG_FILE)")
+	for _, f := range all {
+		fs.Var(&rawFlag{isBool: f.value.Kind() == reflect.Bool}, f.flag, f.help+" (env "+f.env+")")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *configFile != "" {
+		data, err := os.ReadFile(*configFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read config file: %w", err)
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			return nil, nil, fmt.Errorf("parse config file %s: %w", *configFile, err)
+		}
+	}
+
+	for _, f := range all {
+		if raw, ok := os.LookupEnv(f.env); ok && raw != "" {
+			if err := f.set(raw); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", f.env, err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(fl *flag.Flag) {
+		for _, f := range all {
+			if f.flag == fl.Name && flagErr == nil {
+				if err := f.set(fl.Value.String()); err != nil {
+					flagErr = fmt.Errorf("-%s: %w", f.flag, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, nil, flagErr
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port %d is out of range", c.Server.Port))
+	}
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		errs = append(errs, errors.New("server.tls_cert_file and server.tls_key_file must be set together"))
+	}
+	if c.Server.HTTP3 && c.Server.TLSCertFile == "" {
+		errs = append(errs, errors.New("server.http3 requires TLS"))
+	}
+	if c.Server.MaxBodyBytes < 1 {
+		errs = append(errs, fmt.Errorf("server.max_body_bytes %d must be positive", c.Server.MaxBodyBytes))
+	}
+	if c.Server.MaxBatchOperations < 1 {
+		errs = append(errs, fmt.Errorf("server.max_batch_operations %d must be positive", c.Server.MaxBatchOperations))
+	}
+
+	switch c.Database.Driver {
+	case "postgres":
+		if c.Database.URL == "" {
+			errs = append(errs, errors.New("database.url (DATABASE_URL) is required for postgres"))
+		}
+	case "sqlite":
+	default:
+		errs = append(errs, fmt.Errorf("database.driver %q must be postgres or sqlite", c.Database.Driver))
+	}
+
+	if c.Admin.Seeded() {
+		if c.Admin.Email == "" {
+			errs = append(errs, errors.New("admin.email is required with admin.username"))
+		}
+		if (c.Admin.Password == "") == (c.Admin.PasswordFile == "") {
+			errs = append(errs, errors.New("admin.username needs exactly one of admin.password or admin.password_file"))
+		}
+	}
+
+	if c.Auth.SecretFile == "" {
+		errs = append(errs, errors.New("auth.secret_file must be set"))
+	}
+
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		errs = append(errs, fmt.Errorf("log.format %q must be text or json", c.Log.Format))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("log.level %q must be debug, info, warn or error", c.Log.Level))
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter %q must be none, stdout or otlp", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("tracing.sample_ratio must be between 0 and 1"))
+	}
+
+	for _, f := range fields(c) {
+		if d, ok := f.value.Interface().(Duration); ok && d.Duration < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", f.key))
+		}
+	}
+	if c.Auth.TokenTTL.Duration == 0 || c.Auth.ResetTokenTTL.Duration == 0 {
+		errs = append(errs, errors.New("auth token lifetimes must be positive"))
+	}
+	// with no time to drain, every in-flight request would be cut off
+	if c.Server.ShutdownTimeout.Duration == 0 {
+		errs = append(errs, errors.New("server.shutdown_timeout must be positive"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy safe to print, with every secret setting masked
+func (c *Config) Redacted() *Config {
+	copied := *c
+
+	for _, f := range fields(&copied) {
+		if f.secret && f.value.String() != "" {
+			f.value.SetString("[redacted]")
+		}
+	}
+
+	return &copied
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(file, []byte(`{
+		"server": {"port": 9000, "read_timeout": "1m"},
+		"database": {"driver": "sqlite", "query_timeout": "2s"}
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CONFIG_FILE", file)
+	t.Setenv("PORT", "9001")
+	t.Setenv("QUERY_TIMEOUT", "3s")
+
+	cfg, args, err := Load([]string{"-port", "9002", "migrate", "status"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Server.Port != 9002 {
+		t.Errorf("port = %d, flag should win", cfg.Server.Port)
+	}
+	if cfg.Database.QueryTimeout.Duration != 3*time.Second {
+		t.Errorf("query timeout = %s, env should beat the file", cfg.Database.QueryTimeout)
+	}
+	if cfg.Server.ReadTimeout.Duration != time.Minute {
+		t.Errorf("read timeout = %s, file should beat the default", cfg.Server.ReadTimeout)
+	}
+	if cfg.Server.WriteTimeout.Duration != 30*time.Second {
+		t.Errorf("write timeout = %s, default should apply", cfg.Server.WriteTimeout)
+	}
+	if strings.Join(args, " ") != "migrate status" {
+		t.Errorf("args = %v", args)
+	}
+}
+
+func TestLoadRejectsUnknownFileFields(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(file, []byte(`{"server": {"prot": 1}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := Load([]string{"-config", file}, nil); err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Driver = "sqlite"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("defaults with sqlite should be valid: %v", err)
+	}
+
+	cfg.Admin.Username = "root"
+	cfg.Admin.Email = "root@example.com"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "admin.password") {
+		t.Fatalf("seeding an admin without a password should fail, got %v", err)
+	}
+	cfg.Admin.PasswordFile = "admin-password"
+
+	cfg.Server.Port = 0
+	cfg.Server.HTTP3 = true
+	cfg.Server.ShutdownTimeout.Duration = 0
+	cfg.Server.IdempotencyWindow.Duration = -time.Minute
+	cfg.Database.Driver = "mysql"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	if n := strings.Count(err.Error(), "idempotency_window"); n != 1 {
+		t.Errorf("error %q reports idempotency_window %d times, want once", err, n)
+	}
+	for _, want := range []string{"server.port", "http3", "server.shutdown_timeout", "database.driver"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Database.URL = "postgres://user:hunter2@db/app"
+	cfg.Admin.Password = "hunter2"
+
+	redacted := cfg.Redacted()
+	if redacted.Database.URL != "[redacted]" || redacted.Admin.Password != "[redacted]" {
+		t.Errorf("secrets not redacted: %+v", redacted)
+	}
+	if cfg.Admin.Password != "hunter2" {
+		t.Error("Redacted modified the original config")
+	}
+	if redacted.Admin.Username != cfg.Admin.Username {
+		t.Error("non-secret fields should be kept")
+	}
+}
@@ -0,0 +1,562 @@
+package db
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backups are gzip-compressed JSON lines: a header, one record per row, and a
+// trailer with row counts so a truncated archive is never restored. Version
+// 2 added column types and base64 for binary columns
+const (
+	backupFormat  = "signin-api-backup"
+	backupVersion = 2
+)
+
+type backupHeader struct {
+	Format        string    `json:"format"`
+	Version       int       `json:"version"`
+	Dialect       Dialect   `json:"dialect"`
+	SchemaVersion int       `json:"schema_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	// Tables lists every table in restore order, parents before children
+	Tables []string `json:"tables"`
+	// Columns maps each table's stored columns to their declared types
+	Columns map[string]map[string]string `json:"columns,omitempty"`
+}
+
+type backupRecord struct {
+	Table string         `json:"table,omitempty"`
+	Row   map[string]any `json:"row,omitempty"`
+
+	// set only on the trailer
+	End  bool             `json:"end,omitempty"`
+	Rows map[string]int64 `json:"rows,omitempty"`
+}
+
+// BackupStats reports what a backup or restore covered
+type BackupStats struct {
+	SchemaVersion int
+	Rows          map[string]int64
+}
+
+// Backup streams every table to w as a compressed archive. It reads inside
+// one read-only transaction so the archive is a consistent snapshot
+func (c *Conn) Backup(ctx context.Context, w io.Writer) (*BackupStats, error) {
+	var opts *sql.TxOptions
+	if c.Dialect == Postgres {
+		opts = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	}
+
+	sqlTx, err := c.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer sqlTx.Rollback()
+	tx := &Tx{Tx: sqlTx, Dialect: c.Dialect}
+
+	header := backupHeader{
+		Format:    backupFormat,
+		Version:   backupVersion,
+		Dialect:   c.Dialect,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	err = tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&header.SchemaVersion)
+	if err != nil {
+		return nil, fmt.Errorf("read schema version: %w", err)
+	}
+
+	header.Tables, err = orderedTables(ctx, tx, c.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	// generated columns are computed again on restore and can't be inserted,
+	// so they're left out
+	header.Columns = map[string]map[string]string{}
+	for _, table := range header.Tables {
+		if header.Columns[table], err = storedColumns(ctx, tx, c.Dialect, table); err != nil {
+			return nil, fmt.Errorf("read columns of %s: %w", table, err)
+		}
+	}
+
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+
+	if err := enc.Encode(header); err != nil {
+		return nil, err
+	}
+
+	stats := &BackupStats{SchemaVersion: header.SchemaVersion, Rows: map[string]int64{}}
+	for _, table := range header.Tables {
+		n, err := dumpTable(ctx, tx, table, header.Columns[table], enc)
+		if err != nil {
+			return nil, fmt.Errorf("back up %s: %w", table, err)
+		}
+		stats.Rows[table] = n
+	}
+
+	if err := enc.Encode(backupRecord{End: true, Rows: stats.Rows}); err != nil {
+		return nil, err
+	}
+
+	return stats, gz.Close()
+}
+
+// dumpTable writes every row of table, keeping only the given columns
+func dumpTable(ctx context.Context, tx *Tx, table string, types map[string]string, enc *json.Encoder) (int64, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT * FROM "+quoteIdent(table))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	var n int64
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+
+		row := make(map[string]any, len(columns))
+		for i, col := range columns {
+			typ, ok := types[col]
+			if !ok {
+				continue
+			}
+			// drivers hand text and numeric types back as bytes too, but only
+			// binary columns may hold bytes that aren't valid text
+			b, isBytes := values[i].([]byte)
+			switch {
+			case isBytes && binaryType(typ):
+				row[col] = base64.StdEncoding.EncodeToString(b)
+			case isBytes:
+				row[col] = string(b)
+			default:
+				row[col] = values[i]
+			}
+		}
+
+		if err := enc.Encode(backupRecord{Table: table, Row: row}); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, rows.Err()
+}
+
+// Restore loads an archive written by Backup into a database with no data.
+// The schema is first migrated to the archive's version, the rows are
+// inserted in one transaction, and any newer migrations run afterwards
+func (c *Conn) Restore(ctx context.Context, r io.Reader) (*BackupStats, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gz.Close()
+
+	dec := json.NewDecoder(gz)
+	dec.UseNumber()
+
+	var header backupHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("read backup header: %w", err)
+	}
+	if header.Format != backupFormat {
+		return nil, errors.New("not a backup archive")
+	}
+	if header.Version < 1 || header.Version > backupVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", header.Version)
+	}
+
+	if err := c.prepareRestore(ctx, header); err != nil {
+		return nil, err
+	}
+
+	sqlTx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer sqlTx.Rollback()
+	tx := &Tx{Tx: sqlTx, Dialect: c.Dialect}
+
+	stats := &BackupStats{SchemaVersion: header.SchemaVersion, Rows: map[string]int64{}}
+	for _, table := range header.Tables {
+		stats.Rows[table] = 0
+	}
+	var trailer *backupRecord
+
+	for trailer == nil {
+		var rec backupRecord
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("backup archive is truncated")
+			}
+			return nil, fmt.Errorf("read backup: %w", err)
+		}
+
+		if rec.End {
+			trailer = &rec
+			break
+		}
+		if _, ok := stats.Rows[rec.Table]; !ok {
+			return nil, fmt.Errorf("backup has rows for unlisted table %q", rec.Table)
+		}
+
+		if err := insertRow(ctx, tx, rec.Table, rec.Row, header.Columns[rec.Table]); err != nil {
+			return nil, fmt.Errorf("restore %s: %w", rec.Table, err)
+		}
+		stats.Rows[rec.Table]++
+	}
+
+	for table, want := range trailer.Rows {
+		if stats.Rows[table] != want {
+			return nil, fmt.Errorf("backup archive is truncated: %s has %d of %d rows", table, stats.Rows[table], want)
+		}
+	}
+
+	if c.Dialect == Postgres {
+		if err := resetSequences(ctx, tx); err != nil {
+			return nil, fmt.Errorf("reset sequences: %w", err)
+		}
+	}
+
+	if err := sqlTx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// bring an archive from an older release up to date
+	if err := c.MigrateUp(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// prepareRestore migrates to the archive's schema version and checks every
+// table exists and is empty
+func (c *Conn) prepareRestore(ctx context.Context, header backupHeader) error {
+	migrations, err := loadMigrations(c.Dialect)
+	if err != nil {
+		return err
+	}
+	if header.SchemaVersion < 1 {
+		return errors.New("backup was taken from a database with no schema")
+	}
+	if len(migrations) == 0 || header.SchemaVersion > migrations[len(migrations)-1].Version {
+		return fmt.Errorf("backup is at schema version %d, newer than this release supports", header.SchemaVersion)
+	}
+
+	if err := c.migrateUpTo(ctx, header.SchemaVersion); err != nil {
+		return err
+	}
+
+	current, err := c.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if current != header.SchemaVersion {
+		return fmt.Errorf("database is at schema version %d but the backup is at %d; restore into a new database", current, header.SchemaVersion)
+	}
+
+	tables, err := orderedTables(ctx, c, c.Dialect)
+	if err != nil {
+		return err
+	}
+
+	exists := map[string]bool{}
+	for _, table := range tables {
+		exists[table] = true
+
+		var count int
+		if err := c.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+quoteIdent(table)).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("table %s is not empty; restore into a new database", table)
+		}
+	}
+
+	for _, table := range header.Tables {
+		if !exists[table] {
+			return fmt.Errorf("backup table %s does not exist in this database", table)
+		}
+	}
+
+	return nil
+}
+
+// insertRow inserts a row read from an archive. types are the columns' types
+// as the archive recorded them, which older archives don't
+func insertRow(ctx context.Context, tx *Tx, table string, row map[string]any, types map[string]string) error {
+	columns := make([]string, 0, len(row))
+	for col := range row {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+
+	quoted := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	args := make([]any, len(columns))
+	for i, col := range columns {
+		quoted[i] = quoteIdent(col)
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = restoreValue(row[col])
+
+		if s, ok := args[i].(string); ok && binaryType(types[col]) {
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return fmt.Errorf("column %s: %w", col, err)
+			}
+			args[i] = b
+		}
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		quoteIdent(table), strings.Join(quoted, ", "), strings.Join(placeholders, ", "))
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// restoreValue turns a decoded JSON number back into the int or float the
+// driver expects; strings, bools and nulls pass through as they are
+func restoreValue(v any) any {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+// resetSequences moves every serial column's sequence past the restored ids
+func resetSequences(ctx context.Context, tx *Tx) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT table_name, column_name
+		FROM information_schema.columns
+		WHERE table_schema = current_schema() AND column_default LIKE 'nextval(%'
+	`)
+	if err != nil {
+		return err
+	}
+
+	type serial struct{ table, column string }
+	var serials []serial
+	for rows.Next() {
+		var s serial
+		if err := rows.Scan(&s.table, &s.column); err != nil {
+			rows.Close()
+			return err
+		}
+		serials = append(serials, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range serials {
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(
+			"SELECT setval(pg_get_serial_sequence($1, $2), COALESCE((SELECT MAX(%s) FROM %s), 0) + 1, false)",
+			quoteIdent(s.column), quoteIdent(s.table),
+		), s.table, s.column)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", s.table, s.column, err)
+		}
+	}
+
+	return nil
+}
+
+// storedColumns maps the columns of table to their declared types, leaving
+// out the ones the database computes
+func storedColumns(ctx context.Context, q Querier, dialect Dialect, table string) (map[string]string, error) {
+	query := `SELECT name, type FROM pragma_table_xinfo($1) WHERE hidden NOT IN (2, 3)`
+	if dialect == Postgres {
+		query = `
+			SELECT column_name, data_type FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = $1 AND is_generated <> 'ALWAYS'
+		`
+	}
+
+	rows, err := q.QueryContext(ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types := map[string]string{}
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			return nil, err
+		}
+		types[name] = typ
+	}
+	return types, rows.Err()
+}
+
+// binaryType reports whether a column of the declared type holds raw bytes
+func binaryType(typ string) bool {
+	return strings.EqualFold(typ, "bytea") || strings.EqualFold(typ, "blob")
+}
+
+// orderedTables lists the application's tables, leaving out schema_migrations,
+// sorted so every table comes after the tables its foreign keys point at
+func orderedTables(ctx context.Context, q Querier, dialect Dialect) ([]string, error) {
+	tables, err := listTables(ctx, q, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	deps, err := foreignKeys(ctx, q, dialect, tables)
+	if err != nil {
+		return nil, err
+	}
+
+	var ordered []string
+	done := map[string]bool{}
+	for len(ordered) < len(tables) {
+		progress := false
+		for _, table := range tables {
+			if done[table] {
+				continue
+			}
+
+			ready := true
+			for _, parent := range deps[table] {
+				if parent != table && !done[parent] {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				ordered = append(ordered, table)
+				done[table] = true
+				progress = true
+			}
+		}
+
+		if !progress {
+			return nil, errors.New("foreign keys between tables form a cycle")
+		}
+	}
+
+	return ordered, nil
+}
+
+func listTables(ctx context.Context, q Querier, dialect Dialect) ([]string, error) {
+	query := `
+		SELECT name FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+	`
+	if dialect == Postgres {
+		query = `
+			SELECT table_name FROM information_schema.tables
+			WHERE table_schema = current_schema() AND table_type = 'BASE TABLE'
+		`
+	}
+
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		if table != "schema_migrations" {
+			tables = append(tables, table)
+		}
+	}
+
+	sort.Strings(tables)
+	return tables, rows.Err()
+}
+
+// foreignKeys maps each table to the tables it references
+func foreignKeys(ctx context.Context, q Querier, dialect Dialect, tables []string) (map[string][]string, error) {
+	deps := map[string][]string{}
+
+	if dialect == Postgres {
+		rows, err := q.QueryContext(ctx, `
+			SELECT DISTINCT tc.table_name, ccu.table_name
+			FROM information_schema.table_constraints tc
+			JOIN information_schema.constraint_column_usage ccu
+				ON ccu.constraint_name = tc.constraint_name AND ccu.constraint_schema = tc.constraint_schema
+			WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_schema = current_schema()
+		`)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var child, parent string
+			if err := rows.Scan(&child, &parent); err != nil {
+				return nil, err
+			}
+			deps[child] = append(deps[child], parent)
+		}
+
+		return deps, rows.Err()
+	}
+
+	for _, table := range tables {
+		rows, err := q.QueryContext(ctx, `SELECT DISTINCT "table" FROM pragma_foreign_key_list($1)`, table)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var parent string
+			if err := rows.Scan(&parent); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			deps[table] = append(deps[table], parent)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return deps, nil
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
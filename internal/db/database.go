@@ -2,137 +2,99 @@ package db
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
-	"os"
+	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/z-sk1/signin-api/internal/config"
+	_ "modernc.org/sqlite"
 )
 
-var DB *sql.DB
+var DB *Conn
 
-func ensureAdmin() {
-	var count int
+const DefaultQueryTimeout = 5 * time.Second
 
-	err := DB.QueryRow("SELECT COUNT(*) FROM users WHERE role = 'admin'").Scan(&count)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	if count > 0 {
-		return // admin already exists
-	}
+// ErrNotFound is returned by repositories when no row matches
+var ErrNotFound = errors.New("not found")
 
-	password := os.Getenv("ADMIN_PASSWORD")
-	if password == "" {
-		log.Fatal("ADMIN_PASSWORD environment variable not set")
-	}
+// ErrConflict is returned by repositories when a row exists but has changed
+// since the version the caller expected
+var ErrConflict = errors.New("version conflict")
 
-	// hash the password
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// RequireRows turns an update or delete that matched nothing into ErrNotFound
+func RequireRows(res sql.Result) error {
+	n, err := res.RowsAffected()
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
 	}
+	return nil
+}
 
-	_, err = DB.Exec(`
-		INSERT INTO users (email, username, password, role)
-		VALUES ($1, $2, $3, $4)
-	`,
-		"ziad.skafi12@gmail.com",
-		"ziad",
-		hashed,
-		"admin",
-	)
+// Open connects to the configured database without touching the schema.
+// For sqlite the URL is a file path and defaults to signin-api.db
+func Open(cfg config.Database) {
+	connStr := cfg.URL
+	if connStr == "" && Dialect(cfg.Driver) == SQLite {
+		connStr = "signin-api.db"
+	}
 
+	var err error
+	DB, err = Connect(Dialect(cfg.Driver), connStr)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal("Failed to connect to database:", err)
 	}
 
-	log.Println("Default admin account created")
+	DB.QueryTimeout = cfg.QueryTimeout.Duration
 }
 
-func InitDB() {
-	var err error
-
-	connStr := os.Getenv("DATABASE_URL")
-	if connStr == "" {
-		log.Fatal("DATABASE_URL environment variable not set")
+// Connect opens and pings a database of the given dialect
+func Connect(dialect Dialect, connStr string) (*Conn, error) {
+	var driver string
+	switch dialect {
+	case Postgres:
+		driver = "postgres"
+	case SQLite:
+		driver = "sqlite"
+		connStr = sqliteDSN(connStr)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q (want postgres or sqlite)", dialect)
 	}
 
-	DB, err = sql.Open("postgres", connStr)
+	conn, err := sql.Open(driver, connStr)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	err = DB.Ping()
-	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
 	}
 
-	createTables()
+	return &Conn{DB: conn, Dialect: dialect, QueryTimeout: DefaultQueryTimeout}, nil
+}
 
-	ensureAdmin()
+// sqliteDSN turns a bare file path into a DSN with the pragmas the schema relies on
+func sqliteDSN(path string) string {
+	if strings.Contains(path, "?") {
+		return path
+	}
 
-	log.Println("Database successfully initialized")
+	return "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
 }
 
-func createTables() {
-	createTables := `
-	CREATE TABLE IF NOT EXISTS users (
-		id SERIAL PRIMARY KEY,
-		email TEXT NOT NULL UNIQUE,
-		username TEXT NOT NULL UNIQUE,
-		password TEXT NOT NULL,
-		role TEXT NOT NULL DEFAULT 'user'
-	);
-
-	CREATE TABLE IF NOT EXISTS password_resets (
-		email TEXT NOT NULL,
-		token_hash TEXT NOT NULL,
-		expires_at BIGINT NOT NULL
-	);
-
-	CREATE TABLE IF NOT EXISTS notes (
-		id SERIAL PRIMARY KEY,
-		user_id INT NOT NULL REFERENCES users(id),
-		username TEXT NOT NULL,
-		title TEXT,
-		content TEXT,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TABLE IF NOT EXISTS reminders (
-		id SERIAL PRIMARY KEY,
-		user_id INT NOT NULL REFERENCES users(id),
-		username TEXT NOT NULL,
-		title TEXT,
-		content TEXT,
-		due TIMESTAMP NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TABLE IF NOT EXISTS expenses (
-		id SERIAL PRIMARY KEY,
-		user_id INT NOT NULL REFERENCES users(id),
-		username TEXT NOT NULL,
-		amount DOUBLE PRECISION NOT NULL,
-		category TEXT NOT NULL,
-		date TIMESTAMP NOT NULL,
-		note TEXT
-	);
-
-	CREATE TABLE IF NOT EXISTS leaderboard (
-		id SERIAL PRIMARY KEY,
-		user_id INT NOT NULL REFERENCES users(id),
-		username TEXT NOT NULL,
-		section TEXT NOT NULL,
-		name TEXT NOT NULL,
-		points INT NOT NULL
-	);
-	`
-
-	_, err := DB.Exec(createTables)
-	if err != nil {
-		log.Fatal("Failed to create tables:", err)
+// InitDB connects and brings the schema up to date
+func InitDB(cfg config.Database) {
+	Open(cfg)
+
+	if err := DB.MigrateUp(); err != nil {
+		log.Fatal("Failed to run migrations:", err)
 	}
+
+	log.Println("Database successfully initialized")
 }
@@ -0,0 +1,211 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func openTestDB(t *testing.T) *Conn {
+	t.Helper()
+
+	conn, err := Connect(SQLite, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestRebind(t *testing.T) {
+	query := "SELECT '$' FROM users WHERE id = $1 AND name = $2"
+
+	if got := Postgres.Rebind(query); got != query {
+		t.Fatalf("postgres rebind changed query: %s", got)
+	}
+
+	want := "SELECT '$' FROM users WHERE id = ?1 AND name = ?2"
+	if got := SQLite.Rebind(query); got != want {
+		t.Fatalf("sqlite rebind = %s, want %s", got, want)
+	}
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	conn := openTestDB(t)
+
+	if err := conn.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	// running again is a no-op
+	if err := conn.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := conn.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if !s.Applied {
+			t.Fatalf("migration %d not applied", s.Version)
+		}
+	}
+
+	if err := conn.MigrateDown(len(statuses)); err != nil {
+		t.Fatal(err)
+	}
+
+	var tables int
+	conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'users'").Scan(&tables)
+	if tables != 0 {
+		t.Fatal("users table still exists after migrating down")
+	}
+}
+
+func TestWithTxRollsBack(t *testing.T) {
+	conn := openTestDB(t)
+	ctx := context.Background()
+
+	if _, err := conn.Exec("CREATE TABLE items (name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("boom")
+	err := conn.WithTx(ctx, func(tx *Tx) error {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO items(name) VALUES ($1)", "a"); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("WithTx returned %v, want %v", err, failure)
+	}
+
+	err = conn.WithTx(ctx, func(tx *Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO items(name) VALUES ($1)", "b")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	conn.QueryRow("SELECT COUNT(*) FROM items").Scan(&count)
+	if count != 1 {
+		t.Fatalf("got %d rows, want 1", count)
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+
+	src := openTestDB(t)
+	if err := src.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	seed := []string{
+		"INSERT INTO users(email, username, password, role, disabled) VALUES ('a@example.com', 'a', 'hash', 'admin', TRUE)",
+		"INSERT INTO users(email, username, password) VALUES ('b@example.com', 'b', 'hash')",
+		"INSERT INTO notes(user_id, username, title, content) VALUES (2, 'b', 'title', NULL)",
+		"INSERT INTO expenses(user_id, username, amount, category, date) VALUES (2, 'b', 12.5, 'food', '2024-01-02T03:04:05Z')",
+		"INSERT INTO leaderboard(user_id, username, section, name, points) VALUES (1, 'a', 's', 'n', 7)",
+	}
+	for _, query := range seed {
+		if _, err := src.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var archive bytes.Buffer
+	if _, err := src.Backup(ctx, &archive); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := openTestDB(t)
+	stats, err := dst.Restore(ctx, bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Rows["users"] != 2 || stats.Rows["notes"] != 1 || stats.Rows["expenses"] != 1 {
+		t.Fatalf("unexpected restore counts %v", stats.Rows)
+	}
+
+	var disabled bool
+	var amount float64
+	dst.QueryRow("SELECT disabled FROM users WHERE username = 'a'").Scan(&disabled)
+	dst.QueryRow("SELECT amount FROM expenses").Scan(&amount)
+	if !disabled || amount != 12.5 {
+		t.Fatalf("restored values differ: disabled=%v amount=%v", disabled, amount)
+	}
+
+	// new rows carry on after the restored ids
+	var id int
+	err = dst.QueryRow("INSERT INTO users(email, username, password) VALUES ('c@example.com', 'c', 'hash') RETURNING id").Scan(&id)
+	if err != nil || id != 3 {
+		t.Fatalf("new user got id %d (%v), want 3", id, err)
+	}
+
+	// only empty databases can be restored into
+	if _, err := dst.Restore(ctx, bytes.NewReader(archive.Bytes())); err == nil {
+		t.Fatal("restore into a non-empty database succeeded")
+	}
+
+	// and a cut-off archive is rejected without leaving rows behind
+	fresh := openTestDB(t)
+	if _, err := fresh.Restore(ctx, bytes.NewReader(archive.Bytes()[:archive.Len()-20])); err == nil {
+		t.Fatal("truncated archive restored")
+	}
+	var users int
+	fresh.QueryRow("SELECT COUNT(*) FROM users").Scan(&users)
+	if users != 0 {
+		t.Fatalf("truncated restore left %d users", users)
+	}
+}
+
+func TestBackupRestoreBinary(t *testing.T) {
+	ctx := context.Background()
+
+	src := openTestDB(t)
+	if err := src.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a stored response body: JSON with escapes, then bytes that aren't UTF-8
+	body := append([]byte(`{"title":"\"a\" <b> \\"}`), 0xff, 0x00, 0xfe)
+	if _, err := src.Exec("INSERT INTO users(email, username, password) VALUES ('a@example.com', 'a', 'hash')"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := src.Exec("INSERT INTO idempotency_keys(user_id, idempotency_key, request_hash, status, body, expires_at) VALUES (1, 'k', 'h', 200, $1, 1)", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	if _, err := src.Backup(ctx, &archive); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := openTestDB(t)
+	if _, err := dst.Restore(ctx, bytes.NewReader(archive.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []byte
+	if err := dst.QueryRow("SELECT body FROM idempotency_keys").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Fatalf("restored body %q, want %q", got, body)
+	}
+
+	var typ string
+	dst.QueryRow("SELECT typeof(body) FROM idempotency_keys").Scan(&typ)
+	if typ != "blob" {
+		t.Fatalf("restored body is stored as %s, want blob", typ)
+	}
+}
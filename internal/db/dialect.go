@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+// Querier is satisfied by both Conn and Tx, so repository code can run
+// either on its own or as part of a larger transaction
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Conn wraps *sql.DB so queries written with postgres-style $N placeholders
+// run unchanged on every supported backend
+type Conn struct {
+	*sql.DB
+	Dialect Dialect
+	// QueryTimeout bounds each repository call; zero means no limit
+	QueryTimeout time.Duration
+}
+
+// Rebind rewrites $N placeholders into the form the dialect's driver expects
+func (d Dialect) Rebind(query string) string {
+	if d != SQLite || !strings.Contains(query, "$") {
+		return query
+	}
+
+	// sqlite numbers ?N parameters the same way postgres numbers $N
+	var b strings.Builder
+	b.Grow(len(query))
+	for i := 0; i < len(query); i++ {
+		if query[i] == '$' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9' {
+			b.WriteByte('?')
+			continue
+		}
+		b.WriteByte(query[i])
+	}
+	return b.String()
+}
+
+// WithTimeout derives a context bounded by QueryTimeout. The request context
+// is the parent, so a client disconnecting also cancels the query
+func (c *Conn) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.QueryTimeout)
+}
+
+func (c *Conn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := c.Dialect.startSpan(ctx, query)
+	res, err := c.DB.ExecContext(ctx, c.Dialect.Rebind(query), args...)
+	endSpan(span, err)
+	return res, err
+}
+
+// QueryContext's span covers running the query, not reading the rows
+func (c *Conn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := c.Dialect.startSpan(ctx, query)
+	rows, err := c.DB.QueryContext(ctx, c.Dialect.Rebind(query), args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (c *Conn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := c.Dialect.startSpan(ctx, query)
+	row := c.DB.QueryRowContext(ctx, c.Dialect.Rebind(query), args...)
+	endSpan(span, row.Err())
+	return row
+}
+
+func (c *Conn) Exec(query string, args ...any) (sql.Result, error) {
+	return c.ExecContext(context.Background(), query, args...)
+}
+
+func (c *Conn) Query(query string, args ...any) (*sql.Rows, error) {
+	return c.QueryContext(context.Background(), query, args...)
+}
+
+func (c *Conn) QueryRow(query string, args ...any) *sql.Row {
+	return c.QueryRowContext(context.Background(), query, args...)
+}
@@ -0,0 +1,319 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// one directory of migrations per dialect, kept at the same version numbers
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// key for pg_advisory_lock so only one replica migrates at a time
+const migrationLockKey = 727274
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// loadMigrations reads the dialect's embedded NNNN_name.up.sql / NNNN_name.down.sql
+// pairs and returns them sorted by version
+func loadMigrations(dialect Dialect) ([]Migration, error) {
+	dir := "migrations/" + string(dialect)
+
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+
+	for _, entry := range entries {
+		file := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(file, "."+direction+".sql")
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name.%s.sql", file, direction)
+		}
+
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", file, err)
+		}
+
+		body, err := migrationFiles.ReadFile(dir + "/" + file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// withMigrationLock runs fn on a dedicated connection holding the migration
+// advisory lock, so concurrent replicas starting up wait for each other.
+// sqlite has no advisory locks but also only ever has one process writing
+// the file, and each migration runs in its own transaction anyway
+func (c *Conn) withMigrationLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := c.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if c.Dialect == Postgres {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+			return fmt.Errorf("acquire migration lock: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+	}
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// runMigration executes one migration body and records the change in the same transaction
+func (c *Conn) runMigration(ctx context.Context, conn *sql.Conn, m Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	body := m.Up
+	if !up {
+		body = m.Down
+	}
+
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return err
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, c.Dialect.Rebind("INSERT INTO schema_migrations(version, name) VALUES ($1, $2)"), m.Version, m.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, c.Dialect.Rebind("DELETE FROM schema_migrations WHERE version = $1"), m.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MigrateUp applies every migration that hasn't been applied yet
+func (c *Conn) MigrateUp() error {
+	return c.migrateUpTo(context.Background(), 0)
+}
+
+// migrateUpTo applies pending migrations up to and including version, or all
+// of them when version is 0
+func (c *Conn) migrateUpTo(ctx context.Context, version int) error {
+	migrations, err := loadMigrations(c.Dialect)
+	if err != nil {
+		return err
+	}
+
+	return c.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			if version > 0 && m.Version > version {
+				break
+			}
+
+			if err := c.runMigration(ctx, conn, m, true); err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", m.Version, m.Name, err)
+			}
+
+			slog.Info("applied migration", "version", m.Version, "name", m.Name)
+		}
+
+		return nil
+	})
+}
+
+// MigrateDown rolls back the most recent steps applied migrations
+func (c *Conn) MigrateDown(steps int) error {
+	migrations, err := loadMigrations(c.Dialect)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	return c.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+
+			if m.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down file", m.Version, m.Name)
+			}
+
+			if err := c.runMigration(ctx, conn, m, false); err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", m.Version, m.Name, err)
+			}
+
+			slog.Info("reverted migration", "version", m.Version, "name", m.Name)
+			steps--
+		}
+
+		return nil
+	})
+}
+
+// Status lists every known migration and whether it has been applied
+func (c *Conn) Status() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(c.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	var statuses []MigrationStatus
+
+	err = c.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			appliedAt, ok := applied[m.Version]
+			statuses = append(statuses, MigrationStatus{
+				Version:   m.Version,
+				Name:      m.Name,
+				Applied:   ok,
+				AppliedAt: appliedAt,
+			})
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// SchemaVersion returns the highest applied migration version, 0 for a fresh database
+func (c *Conn) SchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := c.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// PendingMigrations counts migrations not yet applied. Unlike Status it
+// doesn't take the migration lock, so it's cheap enough for readiness probes
+func (c *Conn) PendingMigrations(ctx context.Context) (int, error) {
+	migrations, err := loadMigrations(c.Dialect)
+	if err != nil {
+		return 0, err
+	}
+
+	var applied int
+	err = c.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations").Scan(&applied)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(migrations) - applied, nil
+}
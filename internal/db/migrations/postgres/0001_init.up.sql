@@ -0,0 +1,51 @@
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	email TEXT NOT NULL UNIQUE,
+	username TEXT NOT NULL UNIQUE,
+	password TEXT NOT NULL,
+	role TEXT NOT NULL DEFAULT 'user'
+);
+
+CREATE TABLE IF NOT EXISTS password_resets (
+	email TEXT NOT NULL,
+	token_hash TEXT NOT NULL,
+	expires_at BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS notes (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id),
+	username TEXT NOT NULL,
+	title TEXT,
+	content TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS reminders (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id),
+	username TEXT NOT NULL,
+	title TEXT,
+	content TEXT,
+	due TIMESTAMP NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS expenses (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id),
+	username TEXT NOT NULL,
+	amount DOUBLE PRECISION NOT NULL,
+	category TEXT NOT NULL,
+	date TIMESTAMP NOT NULL,
+	note TEXT
+);
+
+CREATE TABLE IF NOT EXISTS leaderboard (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id),
+	username TEXT NOT NULL,
+	section TEXT NOT NULL,
+	name TEXT NOT NULL,
+	points INT NOT NULL
+);
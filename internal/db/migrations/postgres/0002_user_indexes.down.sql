@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS password_resets_email_idx;
+DROP INDEX IF EXISTS leaderboard_section_idx;
+DROP INDEX IF EXISTS expenses_user_id_idx;
+DROP INDEX IF EXISTS reminders_user_id_idx;
+DROP INDEX IF EXISTS notes_user_id_idx;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	user_id INT NOT NULL REFERENCES users(id),
+	idempotency_key TEXT NOT NULL,
+	request_hash TEXT NOT NULL,
+	status INT NOT NULL DEFAULT 0,
+	content_type TEXT NOT NULL DEFAULT '',
+	body BYTEA,
+	expires_at BIGINT NOT NULL,
+	PRIMARY KEY (user_id, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS expenses_search_idx;
+DROP INDEX IF EXISTS reminders_search_idx;
+DROP INDEX IF EXISTS notes_search_idx;
+
+ALTER TABLE expenses DROP COLUMN search;
+ALTER TABLE reminders DROP COLUMN search;
+ALTER TABLE notes DROP COLUMN search;
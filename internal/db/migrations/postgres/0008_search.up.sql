@@ -0,0 +1,19 @@
+-- titles weigh more than bodies in the ranking of GET /search
+ALTER TABLE notes ADD COLUMN search tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(content, '')), 'B')
+) STORED;
+
+ALTER TABLE reminders ADD COLUMN search tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(content, '')), 'B')
+) STORED;
+
+ALTER TABLE expenses ADD COLUMN search tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('english', coalesce(category, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(note, '')), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS notes_search_idx ON notes USING GIN (search);
+CREATE INDEX IF NOT EXISTS reminders_search_idx ON reminders USING GIN (search);
+CREATE INDEX IF NOT EXISTS expenses_search_idx ON expenses USING GIN (search);
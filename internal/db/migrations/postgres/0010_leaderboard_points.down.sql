@@ -0,0 +1 @@
+DROP INDEX IF EXISTS leaderboard_section_points_idx;
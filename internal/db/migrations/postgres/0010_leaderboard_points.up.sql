@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS leaderboard_section_points_idx ON leaderboard (section, points);
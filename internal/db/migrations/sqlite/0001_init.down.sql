@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS leaderboard;
+DROP TABLE IF EXISTS expenses;
+DROP TABLE IF EXISTS reminders;
+DROP TABLE IF EXISTS notes;
+DROP TABLE IF EXISTS password_resets;
+DROP TABLE IF EXISTS users;
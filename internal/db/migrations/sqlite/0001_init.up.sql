@@ -0,0 +1,51 @@
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	email TEXT NOT NULL UNIQUE,
+	username TEXT NOT NULL UNIQUE,
+	password TEXT NOT NULL,
+	role TEXT NOT NULL DEFAULT 'user'
+);
+
+CREATE TABLE IF NOT EXISTS password_resets (
+	email TEXT NOT NULL,
+	token_hash TEXT NOT NULL,
+	expires_at BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS notes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	username TEXT NOT NULL,
+	title TEXT,
+	content TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS reminders (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	username TEXT NOT NULL,
+	title TEXT,
+	content TEXT,
+	due TIMESTAMP NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS expenses (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	username TEXT NOT NULL,
+	amount REAL NOT NULL,
+	category TEXT NOT NULL,
+	date TIMESTAMP NOT NULL,
+	note TEXT
+);
+
+CREATE TABLE IF NOT EXISTS leaderboard (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	username TEXT NOT NULL,
+	section TEXT NOT NULL,
+	name TEXT NOT NULL,
+	points INTEGER NOT NULL
+);
@@ -0,0 +1,5 @@
+CREATE INDEX IF NOT EXISTS notes_user_id_idx ON notes (user_id);
+CREATE INDEX IF NOT EXISTS reminders_user_id_idx ON reminders (user_id);
+CREATE INDEX IF NOT EXISTS expenses_user_id_idx ON expenses (user_id);
+CREATE INDEX IF NOT EXISTS leaderboard_section_idx ON leaderboard (section);
+CREATE INDEX IF NOT EXISTS password_resets_email_idx ON password_resets (email);
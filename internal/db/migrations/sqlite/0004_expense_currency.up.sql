@@ -0,0 +1 @@
+ALTER TABLE expenses ADD COLUMN currency TEXT NOT NULL DEFAULT 'USD';
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS expenses_user_id_currency_idx;
+DROP INDEX IF EXISTS expenses_user_id_category_idx;
+DROP INDEX IF EXISTS expenses_user_id_amount_idx;
+DROP INDEX IF EXISTS expenses_user_id_date_idx;
+DROP INDEX IF EXISTS reminders_user_id_title_idx;
+DROP INDEX IF EXISTS reminders_user_id_due_idx;
+DROP INDEX IF EXISTS notes_user_id_title_idx;
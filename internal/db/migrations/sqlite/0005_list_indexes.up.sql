@@ -0,0 +1,7 @@
+CREATE INDEX IF NOT EXISTS notes_user_id_title_idx ON notes (user_id, title);
+CREATE INDEX IF NOT EXISTS reminders_user_id_due_idx ON reminders (user_id, due);
+CREATE INDEX IF NOT EXISTS reminders_user_id_title_idx ON reminders (user_id, title);
+CREATE INDEX IF NOT EXISTS expenses_user_id_date_idx ON expenses (user_id, date);
+CREATE INDEX IF NOT EXISTS expenses_user_id_amount_idx ON expenses (user_id, amount);
+CREATE INDEX IF NOT EXISTS expenses_user_id_category_idx ON expenses (user_id, category);
+CREATE INDEX IF NOT EXISTS expenses_user_id_currency_idx ON expenses (user_id, currency);
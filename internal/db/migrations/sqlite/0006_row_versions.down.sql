@@ -0,0 +1,3 @@
+ALTER TABLE expenses DROP COLUMN version;
+ALTER TABLE reminders DROP COLUMN version;
+ALTER TABLE notes DROP COLUMN version;
@@ -0,0 +1,3 @@
+ALTER TABLE notes ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE reminders ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE expenses ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+-- sqlite has no full-text columns; GET /search scans the user's items instead
+SELECT 1;
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/z-sk1/signin-api/internal/db")
+
+// attemptKey records how many tries a retried transaction took
+var attemptKey = attribute.Key("db.transaction.attempt")
+
+// startSpan opens a client span for one statement. Only the SQL text is
+// recorded, never the arguments, which can hold password hashes and emails
+func (d Dialect) startSpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	system := semconv.DBSystemNamePostgreSQL
+	if d == SQLite {
+		system = semconv.DBSystemNameSQLite
+	}
+
+	op := operation(query)
+	return tracer.Start(ctx, "db "+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(system, semconv.DBOperationNameKey.String(op), semconv.DBQueryText(query)),
+	)
+}
+
+// endSpan marks the span failed unless err is nil or just "no rows"
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// operation is the statement's leading keyword, e.g. SELECT
+func operation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "QUERY"
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	maxTxAttempts = 5
+	txRetryDelay  = 20 * time.Millisecond
+)
+
+// Tx wraps *sql.Tx with the same placeholder rewriting as Conn
+type Tx struct {
+	*sql.Tx
+	Dialect Dialect
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := tx.Dialect.startSpan(ctx, query)
+	res, err := tx.Tx.ExecContext(ctx, tx.Dialect.Rebind(query), args...)
+	endSpan(span, err)
+	return res, err
+}
+
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := tx.Dialect.startSpan(ctx, query)
+	rows, err := tx.Tx.QueryContext(ctx, tx.Dialect.Rebind(query), args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := tx.Dialect.startSpan(ctx, query)
+	row := tx.Tx.QueryRowContext(ctx, tx.Dialect.Rebind(query), args...)
+	endSpan(span, row.Err())
+	return row
+}
+
+// WithTx runs fn inside a serializable transaction, committing when it returns
+// nil and rolling back otherwise. Serialization failures, deadlocks and busy
+// sqlite files are retried with a growing delay, so fn must be safe to re-run
+func (c *Conn) WithTx(ctx context.Context, fn func(tx *Tx) error) (err error) {
+	ctx, span := tracer.Start(ctx, "db transaction")
+	defer func() { endSpan(span, err) }()
+
+	for attempt := 1; ; attempt++ {
+		span.SetAttributes(attemptKey.Int(attempt))
+
+		err := c.runTx(ctx, fn)
+		if err == nil || attempt == maxTxAttempts || !isRetryable(err) {
+			return err
+		}
+
+		select {
+		case <-time.After(time.Duration(attempt) * txRetryDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *Conn) runTx(ctx context.Context, fn func(tx *Tx) error) error {
+	var opts *sql.TxOptions
+	if c.Dialect == Postgres {
+		// sqlite transactions are always serializable and reject explicit levels
+		opts = &sql.TxOptions{Isolation: sql.LevelSerializable}
+	}
+
+	sqlTx, err := c.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	tx := &Tx{Tx: sqlTx, Dialect: c.Dialect}
+	if err := fn(tx); err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+
+	return sqlTx.Commit()
+}
+
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// serialization_failure, deadlock_detected
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		code := sqliteErr.Code() & 0xff
+		return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+	}
+
+	return false
+}
+
+type txKey struct{}
+
+// InTx is WithTx for code that reaches the database through Using: every call
+// made with the context fn receives joins the transaction. Inside another
+// InTx it runs fn in the transaction already open
+func (c *Conn) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*Tx); ok {
+		return fn(ctx)
+	}
+
+	return c.WithTx(ctx, func(tx *Tx) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// Using returns the transaction InTx opened for ctx, or c outside of one
+func (c *Conn) Using(ctx context.Context) Querier {
+	if tx, ok := ctx.Value(txKey{}).(*Tx); ok {
+		return tx
+	}
+	return c
+}
@@ -0,0 +1,48 @@
+// Package etag builds entity tags and evaluates the If-Match and
+// If-None-Match preconditions against them (RFC 9110 section 13)
+package etag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// Version is the strong tag of a row at a version
+func Version(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// Of is a weak tag for a response body, for representations without a
+// version of their own such as a page of a list
+func Of(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// Match reports whether a header lists tag or is "*". If-Match needs strong
+// comparison, so weak tags on either side never match it; If-None-Match
+// compares weakly
+func Match(header, tag string, weak bool) bool {
+	if !weak && strings.HasPrefix(tag, "W/") {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = candidate[2:]
+		}
+		if candidate == strings.TrimPrefix(tag, "W/") {
+			return true
+		}
+	}
+	return false
+}
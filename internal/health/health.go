@@ -0,0 +1,95 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// how long /readyz waits on all checks before reporting not ready
+const checkTimeout = 3 * time.Second
+
+// Check reports whether one dependency is usable; a nil error means healthy
+type Check func(ctx context.Context) error
+
+// Checker backs the liveness and readiness endpoints
+type Checker struct {
+	mu       sync.RWMutex
+	checks   map[string]Check
+	draining atomic.Bool
+}
+
+func NewChecker() *Checker {
+	return &Checker{checks: map[string]Check{}}
+}
+
+// Register adds a named dependency check to readiness
+func (h *Checker) Register(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks[name] = check
+}
+
+// Drain marks the instance as shutting down so readiness fails and the
+// orchestrator stops routing new traffic here
+func (h *Checker) Drain() {
+	h.draining.Store(true)
+}
+
+// Liveness only says the process is serving requests
+func (h *Checker) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readiness runs every registered check concurrently
+func (h *Checker) Readiness(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), checkTimeout)
+	defer cancel()
+
+	h.mu.RLock()
+	names := make([]string, 0, len(h.checks))
+	for name := range h.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = check(ctx)
+		}(i, h.checks[name])
+	}
+	h.mu.RUnlock()
+	wg.Wait()
+
+	status := http.StatusOK
+	checks := gin.H{}
+	for i, name := range names {
+		if results[i] != nil {
+			status = http.StatusServiceUnavailable
+			checks[name] = results[i].Error()
+		} else {
+			checks[name] = "ok"
+		}
+	}
+
+	if status == http.StatusOK {
+		c.JSON(status, gin.H{"status": "ready", "checks": checks})
+	} else {
+		c.JSON(status, gin.H{"status": "unavailable", "checks": checks})
+	}
+}
@@ -0,0 +1,71 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func get(t *testing.T, handler gin.HandlerFunc) (int, map[string]any) {
+	t.Helper()
+
+	r := gin.New()
+	r.GET("/", handler)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, body
+}
+
+func TestReadiness(t *testing.T) {
+	checker := NewChecker()
+	checker.Register("database", func(ctx context.Context) error { return nil })
+
+	if code, body := get(t, checker.Readiness); code != http.StatusOK || body["status"] != "ready" {
+		t.Fatalf("got %d %v, want ready", code, body)
+	}
+
+	checker.Register("mail", func(ctx context.Context) error { return errors.New("smtp unreachable") })
+
+	code, body := get(t, checker.Readiness)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d, want 503", code)
+	}
+	checks := body["checks"].(map[string]any)
+	if checks["database"] != "ok" || checks["mail"] != "smtp unreachable" {
+		t.Fatalf("unexpected checks %v", checks)
+	}
+}
+
+func TestDrainFailsReadinessNotLiveness(t *testing.T) {
+	checker := NewChecker()
+	checker.Drain()
+
+	if code, _ := get(t, checker.Readiness); code != http.StatusServiceUnavailable {
+		t.Fatalf("readiness returned %d while draining", code)
+	}
+	if code, _ := get(t, checker.Liveness); code != http.StatusOK {
+		t.Fatalf("liveness returned %d while draining", code)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	code, body := get(t, VersionHandler)
+	if code != http.StatusOK || body["go_version"] == "" || body["version"] != Version {
+		t.Fatalf("unexpected version response %d %v", code, body)
+	}
+}
@@ -0,0 +1,198 @@
+// Package idempotency lets clients retry POST requests safely. A request sent
+// with an Idempotency-Key header runs once per user and key; retries within
+// the window get the first response back instead of running again.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/z-sk1/signin-api/internal/apierror"
+)
+
+const (
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set to "true" on responses replayed from an earlier request
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+)
+
+// replayedHeaders are the response headers kept along with the body, so a
+// replayed create still says where the item is and what version it's at
+var replayedHeaders = []string{"Location", "ETag"}
+
+// Record is a key and, once its request has finished, the response to replay
+type Record struct {
+	UserID int
+	Key    string
+	// RequestHash identifies the request first sent with the key, so the key
+	// can't be reused for a different one
+	RequestHash string
+	// Status is 0 while the first request is still running
+	Status      int
+	ContentType string
+	// Headers holds the replayedHeaders the response set
+	Headers http.Header
+	Body    []byte
+	// ExpiresAt is the unix time after which the key may be used again
+	ExpiresAt int64
+}
+
+// Repository stores keys per user
+type Repository interface {
+	// Reserve claims rec.Key for a new request. When the user already holds
+	// the key and it hasn't expired, it returns that record instead
+	Reserve(ctx context.Context, rec Record) (*Record, error)
+	// Complete stores the response of the request holding the key
+	Complete(ctx context.Context, rec Record) error
+	// Release frees a key whose request didn't produce a response worth
+	// replaying, so a retry runs it again
+	Release(ctx context.Context, userID int, key string) error
+	// PurgeExpired deletes keys that expired before the unix time and returns
+	// how many were removed
+	PurgeExpired(ctx context.Context, before int64) (int64, error)
+}
+
+// Middleware makes POST requests carrying an Idempotency-Key run at most once
+// per user and key within window. It must run after authentication.
+//
+// route names the route a request was matched to, such as "/notes" for both
+// /notes and /v1/notes, so a retry is recognised whichever alias it's sent to.
+// Without it the route is used as registered
+//
+// Only responses the handler writes itself below 500 are kept. Errors reported
+// through apierror and server failures release the key, since they leave
+// nothing behind and the client should be able to retry them
+func Middleware(repo Repository, window time.Duration, route func(path string) string) gin.HandlerFunc {
+	if route == nil {
+		route = func(path string) string { return path }
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(Header)
+		if key == "" || c.Request.Method != http.MethodPost {
+			c.Next()
+			return
+		}
+		if len(key) > maxKeyLength {
+			apierror.Abort(c, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "Idempotency-Key must be at most 255 characters"))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			apierror.Abort(c, apierror.Bind(err))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := c.Request.Context()
+		rec := Record{
+			UserID:      c.GetInt("user_id"),
+			Key:         key,
+			RequestHash: hash(c.Request.Method, route(c.FullPath()), c.Params, body),
+			ExpiresAt:   time.Now().Add(window).Unix(),
+		}
+
+		existing, err := repo.Reserve(ctx, rec)
+		if err != nil {
+			apierror.Abort(c, apierror.Internal("failed to check idempotency key", err))
+			return
+		}
+		if existing != nil {
+			replay(c, rec, existing)
+			return
+		}
+
+		// a panic or an error below leaves the key free for the next attempt;
+		// the request may have been cancelled, so don't depend on its context
+		stored := false
+		defer func() {
+			if stored {
+				return
+			}
+			if err := repo.Release(context.WithoutCancel(ctx), rec.UserID, rec.Key); err != nil {
+				slog.ErrorContext(ctx, "failed to release idempotency key", "error", err)
+			}
+		}()
+
+		w := &recorder{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		if !w.Written() || w.Status() >= http.StatusInternalServerError {
+			return
+		}
+
+		rec.Status = w.Status()
+		rec.ContentType = w.Header().Get("Content-Type")
+		rec.Headers = http.Header{}
+		for _, name := range replayedHeaders {
+			if v := w.Header().Values(name); len(v) > 0 {
+				rec.Headers[name] = v
+			}
+		}
+		rec.Body = w.body.Bytes()
+		if err := repo.Complete(context.WithoutCancel(ctx), rec); err != nil {
+			slog.ErrorContext(ctx, "failed to store idempotent response", "error", err)
+			return
+		}
+		stored = true
+	}
+}
+
+// replay answers a retry with the response to the first request
+func replay(c *gin.Context, rec Record, existing *Record) {
+	if existing.RequestHash != rec.RequestHash {
+		apierror.Abort(c, apierror.New(http.StatusUnprocessableEntity, apierror.CodeIdempotencyReused, "Idempotency-Key was already used for a different request"))
+		return
+	}
+	if existing.Status == 0 {
+		apierror.Abort(c, apierror.New(http.StatusConflict, apierror.CodeIdempotencyInUse, "a request with this Idempotency-Key is still in progress"))
+		return
+	}
+
+	for name, values := range existing.Headers {
+		for _, v := range values {
+			c.Writer.Header().Add(name, v)
+		}
+	}
+	c.Header(ReplayedHeader, "true")
+	c.Data(existing.Status, existing.ContentType, existing.Body)
+	c.Abort()
+}
+
+// hash identifies a request by its method, route, path parameters and body
+func hash(method, route string, params gin.Params, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, method+" "+route+"\n")
+	for _, p := range params {
+		io.WriteString(h, p.Key+"="+p.Value+"\n")
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recorder keeps a copy of the response body as it's written
+type recorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,76 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/z-sk1/signin-api/internal/db"
+)
+
+type entry struct {
+	userID int
+	key    string
+}
+
+type memoryRepository struct {
+	mu      sync.Mutex
+	records map[entry]Record
+}
+
+// NewMemoryRepository returns a Repository backed by process memory, used in tests
+func NewMemoryRepository() Repository {
+	return &memoryRepository{records: map[entry]Record{}}
+}
+
+func (r *memoryRepository) Reserve(ctx context.Context, rec Record) (*Record, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := entry{rec.UserID, rec.Key}
+	if existing, ok := r.records[k]; ok && existing.ExpiresAt >= time.Now().Unix() {
+		return &existing, nil
+	}
+
+	r.records[k] = Record{UserID: rec.UserID, Key: rec.Key, RequestHash: rec.RequestHash, ExpiresAt: rec.ExpiresAt}
+	return nil, nil
+}
+
+func (r *memoryRepository) Complete(ctx context.Context, rec Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k := entry{rec.UserID, rec.Key}
+	existing, ok := r.records[k]
+	if !ok {
+		return db.ErrNotFound
+	}
+
+	existing.Status, existing.ContentType = rec.Status, rec.ContentType
+	existing.Headers = rec.Headers.Clone()
+	existing.Body = append([]byte(nil), rec.Body...)
+	r.records[k] = existing
+	return nil
+}
+
+func (r *memoryRepository) Release(ctx context.Context, userID int, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.records, entry{userID, key})
+	return nil
+}
+
+func (r *memoryRepository) PurgeExpired(ctx context.Context, before int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for k, rec := range r.records {
+		if rec.ExpiresAt < before {
+			delete(r.records, k)
+			purged++
+		}
+	}
+	return purged, nil
+}
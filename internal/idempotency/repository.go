@@ -0,0 +1,100 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/z-sk1/signin-api/internal/db"
+)
+
+type sqlRepository struct {
+	conn *db.Conn
+}
+
+func NewSQLRepository(conn *db.Conn) Repository {
+	return &sqlRepository{conn: conn}
+}
+
+func (r *sqlRepository) Reserve(ctx context.Context, rec Record) (*Record, error) {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	var existing *Record
+	err := r.conn.WithTx(ctx, func(tx *db.Tx) error {
+		existing = nil
+
+		// an expired key is free again; the purge job may not have run yet
+		_, err := tx.ExecContext(ctx,
+			"DELETE FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2 AND expires_at < $3",
+			rec.UserID, rec.Key, time.Now().Unix(),
+		)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx,
+			"INSERT INTO idempotency_keys (user_id, idempotency_key, request_hash, expires_at) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING",
+			rec.UserID, rec.Key, rec.RequestHash, rec.ExpiresAt,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 1 {
+			return err
+		}
+
+		var headers string
+		existing = &Record{UserID: rec.UserID, Key: rec.Key}
+		err = tx.QueryRowContext(ctx,
+			"SELECT request_hash, status, content_type, headers, body, expires_at FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2",
+			rec.UserID, rec.Key,
+		).Scan(&existing.RequestHash, &existing.Status, &existing.ContentType, &headers, &existing.Body, &existing.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal([]byte(headers), &existing.Headers)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func (r *sqlRepository) Complete(ctx context.Context, rec Record) error {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	headers, err := json.Marshal(rec.Headers)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.conn.ExecContext(ctx,
+		"UPDATE idempotency_keys SET status = $1, content_type = $2, headers = $3, body = $4 WHERE user_id = $5 AND idempotency_key = $6",
+		rec.Status, rec.ContentType, string(headers), rec.Body, rec.UserID, rec.Key,
+	)
+	if err != nil {
+		return err
+	}
+	return db.RequireRows(res)
+}
+
+func (r *sqlRepository) Release(ctx context.Context, userID int, key string) error {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := r.conn.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2", userID, key)
+	return err
+}
+
+func (r *sqlRepository) PurgeExpired(ctx context.Context, before int64) (int64, error) {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	res, err := r.conn.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
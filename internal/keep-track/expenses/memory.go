@@ -0,0 +1,43 @@
+package expenses
+
+import (
+	"context"
+
+	"github.com/z-sk1/signin-api/internal/resource"
+)
+
+type memoryRepository struct {
+	*resource.MemoryStore[Expense, *Expense]
+}
+
+// NewMemoryRepository returns a Repository backed by process memory, used in tests
+func NewMemoryRepository() Repository {
+	return memoryRepository{resource.NewMemoryStore[Expense](columns)}
+}
+
+func (r memoryRepository) Total(ctx context.Context, userID int) (float64, error) {
+	expenses := r.Owned(userID)
+
+	var total float64
+	for _, expense := range expenses {
+		total += expense.Amount
+	}
+	return total, nil
+}
+
+func (r memoryRepository) Categories(ctx context.Context, userID int) ([]CategoryTotal, error) {
+	expenses := r.Owned(userID)
+
+	var results []CategoryTotal
+	index := map[string]int{}
+	for _, expense := range expenses {
+		i, ok := index[expense.Category]
+		if !ok {
+			i = len(results)
+			index[expense.Category] = i
+			results = append(results, CategoryTotal{Category: expense.Category})
+		}
+		results[i].Total += expense.Amount
+	}
+	return results, nil
+}
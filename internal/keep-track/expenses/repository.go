@@ -0,0 +1,92 @@
+package expenses
+
+import (
+	"context"
+
+	"github.com/z-sk1/signin-api/internal/db"
+	"github.com/z-sk1/signin-api/internal/listquery"
+	"github.com/z-sk1/signin-api/internal/resource"
+)
+
+type CategoryTotal struct {
+	Category string  `json:"category"`
+	Total    float64 `json:"total"`
+}
+
+// Repository stores expenses; every method is scoped to the owning user
+type Repository interface {
+	resource.Store[Expense]
+	Total(ctx context.Context, userID int) (float64, error)
+	Categories(ctx context.Context, userID int) ([]CategoryTotal, error)
+}
+
+// ListSpec is what expenses can be sorted and filtered by
+var ListSpec = listquery.Spec{Fields: []listquery.Field{
+	{Name: "date", Column: "date", Kind: listquery.Time, Sort: true, Filter: true},
+	{Name: "amount", Column: "amount", Kind: listquery.Float, Sort: true, Filter: true},
+	{Name: "category", Column: "category", Kind: listquery.String, Sort: true, Filter: true},
+	{Name: "currency", Column: "currency", Kind: listquery.String, Sort: true, Filter: true},
+}}
+
+var columns = resource.Columns[Expense]{
+	Table:    "expenses",
+	Writable: []string{"amount", "currency", "category", "date", "note"},
+	Values:   func(e *Expense) []any { return []any{e.Amount, e.Currency, e.Category, e.Date, e.Note} },
+	Read:     []string{"amount", "currency", "category", "date", "note"},
+	Dest:     func(e *Expense) []any { return []any{&e.Amount, &e.Currency, &e.Category, &e.Date, &e.Note} },
+	Field: func(e Expense, name string) any {
+		switch name {
+		case "id":
+			return e.ID
+		case "date":
+			return e.Date
+		case "amount":
+			return e.Amount
+		case "category":
+			return e.Category
+		case "currency":
+			return e.Currency
+		}
+		return nil
+	},
+}
+
+type sqlRepository struct {
+	*resource.SQLStore[Expense, *Expense]
+	conn *db.Conn
+}
+
+func NewSQLRepository(conn *db.Conn) Repository {
+	return &sqlRepository{SQLStore: resource.NewSQLStore[Expense](conn, columns), conn: conn}
+}
+
+func (r *sqlRepository) Total(ctx context.Context, userID int) (float64, error) {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	var total float64
+	err := r.conn.QueryRowContext(ctx, "SELECT COALESCE(SUM(amount), 0) FROM expenses WHERE user_id = $1", userID).Scan(&total)
+	return total, err
+}
+
+func (r *sqlRepository) Categories(ctx context.Context, userID int) ([]CategoryTotal, error) {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.conn.QueryContext(ctx, "SELECT category, COALESCE(SUM(amount), 0) FROM expenses WHERE user_id = $1 GROUP BY category", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []CategoryTotal
+	for rows.Next() {
+		var ct CategoryTotal
+		if err := rows.Scan(&ct.Category, &ct.Total); err != nil {
+			return nil, err
+		}
+		results = append(results, ct)
+	}
+
+	return results, rows.Err()
+}
@@ -0,0 +1,507 @@
+// Package listquery parses the pagination, sorting and filtering parameters
+// shared by every list endpoint, and applies them in SQL or in memory.
+//
+//	GET /v1/expenses?sort=-date&category=food&date[gte]=2030-01-01T00:00:00Z&limit=20
+//
+// Results are ordered by the sort field and then id, so the opaque cursor
+// returned with each page can seek to exactly where it left off.
+package listquery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/z-sk1/signin-api/internal/apierror"
+	"github.com/z-sk1/signin-api/internal/etag"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// TotalCountHeader carries the number of items matching the filters
+const TotalCountHeader = "X-Total-Count"
+
+type Kind int
+
+const (
+	String Kind = iota
+	Int
+	Float
+	// Time values are RFC 3339 strings, compared once normalised by Timestamp
+	Time
+)
+
+// Field is one column clients may sort or filter a list by
+type Field struct {
+	Name   string
+	Column string
+	Kind   Kind
+	// Sort is only set for indexed columns
+	Sort   bool
+	Filter bool
+}
+
+// Spec lists the fields of one resource
+type Spec struct {
+	Fields []Field
+	// DefaultSort is the sort used when none is given, such as "-points";
+	// lists are sorted by id when it's empty
+	DefaultSort string
+}
+
+type Op string
+
+const (
+	Eq  Op = "eq"
+	Gt  Op = "gt"
+	Gte Op = "gte"
+	Lt  Op = "lt"
+	Lte Op = "lte"
+)
+
+var operators = map[Op]string{Eq: "=", Gt: ">", Gte: ">=", Lt: "<", Lte: "<="}
+
+type Filter struct {
+	Field Field
+	Op    Op
+	Value any
+}
+
+// Query is a parsed list request. The zero value lists everything by id
+type Query struct {
+	// Limit is the page size; zero means no limit
+	Limit   int
+	Sort    Field
+	Desc    bool
+	Filters []Filter
+
+	after *cursor
+}
+
+// id orders ties and is always sortable
+var idField = Field{Name: "id", Column: "id", Kind: Int, Sort: true, Filter: true}
+
+func (s Spec) field(name string) (Field, bool) {
+	if name == idField.Name {
+		return idField, true
+	}
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// Parse reads limit, sort, cursor and filter parameters. Filters are written
+// field=value for equality or field[op]=value with op one of gt, gte, lt, lte.
+// Other parameters, such as a cache buster, are ignored unless they name a
+// field or use the field[op] form, so a mistyped filter still fails loudly
+func (s Spec) Parse(values url.Values) (Query, *apierror.Error) {
+	q := Query{Limit: DefaultLimit, Sort: idField}
+
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxLimit {
+			return Query{}, apierror.InvalidField("limit", "out_of_range", fmt.Sprintf("must be between 1 and %d", MaxLimit))
+		}
+		q.Limit = n
+	}
+
+	v := values.Get("sort")
+	if v == "" {
+		v = s.DefaultSort
+	}
+	if v != "" {
+		name := strings.TrimPrefix(v, "-")
+		f, ok := s.field(name)
+		if !ok || !f.Sort {
+			return Query{}, apierror.InvalidField("sort", "unsupported", "cannot sort by "+name)
+		}
+		q.Sort, q.Desc = f, strings.HasPrefix(v, "-")
+	}
+
+	for key, vals := range values {
+		switch key {
+		case "limit", "sort", "cursor":
+			continue
+		}
+
+		name, op, bracketed := key, Eq, false
+		if i := strings.IndexByte(key, '['); i > 0 && strings.HasSuffix(key, "]") {
+			name, op, bracketed = key[:i], Op(key[i+1:len(key)-1]), true
+		}
+
+		f, ok := s.field(name)
+		if !ok && !bracketed {
+			continue
+		}
+		if !ok || !f.Filter {
+			return Query{}, apierror.InvalidField(key, "unsupported", "cannot filter by "+name)
+		}
+		if _, ok := operators[op]; !ok || (op != Eq && f.Kind == String) {
+			return Query{}, apierror.InvalidField(key, "unsupported", "unsupported operator "+string(op))
+		}
+
+		value, err := parseValue(f.Kind, vals[0])
+		if err != nil {
+			return Query{}, apierror.InvalidField(key, "invalid_format", err.Error())
+		}
+		q.Filters = append(q.Filters, Filter{Field: f, Op: op, Value: value})
+	}
+
+	// map iteration order mustn't leak into the SQL
+	sort.Slice(q.Filters, func(i, j int) bool {
+		a, b := q.Filters[i], q.Filters[j]
+		return a.Field.Name < b.Field.Name || (a.Field.Name == b.Field.Name && a.Op < b.Op)
+	})
+
+	if v := values.Get("cursor"); v != "" {
+		kind := q.Sort.Kind
+		if q.sortName() == idField.Name {
+			kind = Int
+		}
+		c, err := decodeCursor(v, q.sortKey(), kind)
+		if err != nil {
+			return Query{}, apierror.InvalidField("cursor", "invalid", "cursor is invalid or was issued for a different sort")
+		}
+		q.after = c
+	}
+
+	return q, nil
+}
+
+func parseValue(kind Kind, v string) (any, error) {
+	switch kind {
+	case Int:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		return n, nil
+	case Float:
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return n, nil
+	case Time:
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("must be an RFC 3339 timestamp")
+		}
+		return Timestamp(t), nil
+	}
+	return v, nil
+}
+
+// Timestamp formats t the way Time fields are stored, so they order the same
+// as strings as they do as times
+func Timestamp(t time.Time) string {
+	return t.UTC().Truncate(time.Second).Format(time.RFC3339)
+}
+
+// NormalizeTime rewrites an RFC 3339 value as Timestamp does, so that Time
+// fields filter and sort correctly; other values are returned unchanged
+func NormalizeTime(v string) string {
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return v
+	}
+	return Timestamp(t)
+}
+
+func (q Query) sortKey() string {
+	if q.Desc {
+		return "-" + q.Sort.Name
+	}
+	return q.Sort.Name
+}
+
+func (q Query) sortField() Field {
+	if q.Sort.Column == "" {
+		return idField
+	}
+	return q.Sort
+}
+
+// cursor is the last item of the previous page
+type cursor struct {
+	Sort  string          `json:"s"`
+	Value json.RawMessage `json:"v"`
+	ID    int             `json:"id"`
+	// Offset counts the items on earlier pages
+	Offset int `json:"o,omitempty"`
+
+	value any
+}
+
+func decodeCursor(s, sortKey string, kind Kind) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.Sort != sortKey {
+		return nil, fmt.Errorf("cursor sort %q doesn't match %q", c.Sort, sortKey)
+	}
+
+	switch kind {
+	case Int:
+		var n int
+		err = json.Unmarshal(c.Value, &n)
+		c.value = n
+	case Float:
+		var n float64
+		err = json.Unmarshal(c.Value, &n)
+		c.value = n
+	default:
+		var v string
+		err = json.Unmarshal(c.Value, &v)
+		c.value = v
+	}
+	return &c, err
+}
+
+func (q Query) encodeCursor(value any, id, offset int) string {
+	raw, _ := json.Marshal(value)
+	data, _ := json.Marshal(cursor{Sort: q.sortKey(), Value: raw, ID: id, Offset: offset})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Offset is how many items came before this page, as counted when its cursor
+// was issued
+func (q Query) Offset() int {
+	if q.after == nil {
+		return 0
+	}
+	return q.after.Offset
+}
+
+// Where appends the filters to conds and args, numbering placeholders after
+// the args already there
+func (q Query) Where(conds []string, args []any) ([]string, []any) {
+	for _, f := range q.Filters {
+		args = append(args, f.Value)
+		conds = append(conds, fmt.Sprintf("%s %s $%d", f.Field.Column, operators[f.Op], len(args)))
+	}
+	return conds, args
+}
+
+// Seek appends the filters and the condition that skips past the cursor
+func (q Query) Seek(conds []string, args []any) ([]string, []any) {
+	conds, args = q.Where(conds, args)
+	if q.after == nil {
+		return conds, args
+	}
+
+	op := ">"
+	if q.Desc {
+		op = "<"
+	}
+
+	col := q.sortField().Column
+	if col == idField.Column {
+		args = append(args, q.after.ID)
+		return append(conds, fmt.Sprintf("id %s $%d", op, len(args))), args
+	}
+
+	args = append(args, q.after.value, q.after.ID)
+	n := len(args)
+	return append(conds, fmt.Sprintf("(%s %s $%d OR (%s = $%d AND id %s $%d))", col, op, n-1, col, n-1, op, n)), args
+}
+
+// OrderBy is the ORDER BY clause matching the cursor
+func (q Query) OrderBy() string {
+	dir := "ASC"
+	if q.Desc {
+		dir = "DESC"
+	}
+
+	col := q.sortField().Column
+	if col == idField.Column {
+		return "id " + dir
+	}
+	return col + " " + dir + ", id " + dir
+}
+
+// LimitClause fetches one row more than a page, which tells Finish whether
+// there is a next page; it's empty when there's no limit
+func (q Query) LimitClause() string {
+	if q.Limit == 0 {
+		return ""
+	}
+	return " LIMIT " + strconv.Itoa(q.Limit+1)
+}
+
+// Page is one page of results
+type Page[T any] struct {
+	Items []T
+	Total int
+	// Next is the cursor for the following page, empty on the last one
+	Next string
+}
+
+// Accessor returns an item's value for a field name; it must handle "id" and
+// every field of the spec
+type Accessor[T any] func(item T, field string) any
+
+// Finish trims the extra row a SQL query fetched and sets the next cursor
+func Finish[T any](q Query, items []T, total int, get Accessor[T]) Page[T] {
+	page := Page[T]{Items: items, Total: total}
+	if q.Limit > 0 && len(items) > q.Limit {
+		page.Items = items[:q.Limit]
+		last := page.Items[q.Limit-1]
+		page.Next = q.encodeCursor(get(last, q.sortName()), get(last, "id").(int), q.Offset()+q.Limit)
+	}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	return page
+}
+
+// Apply runs q over items in memory, for the memory repositories
+func Apply[T any](q Query, items []T, get Accessor[T]) Page[T] {
+	var matched []T
+	for _, item := range items {
+		if matches(q, item, get) {
+			matched = append(matched, item)
+		}
+	}
+	total := len(matched)
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		c := order(q, matched[i], get(matched[j], q.sortName()), get(matched[j], "id").(int), get)
+		if q.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	if q.after != nil {
+		start := len(matched)
+		for i, item := range matched {
+			c := order(q, item, q.after.value, q.after.ID, get)
+			if (!q.Desc && c > 0) || (q.Desc && c < 0) {
+				start = i
+				break
+			}
+		}
+		matched = matched[start:]
+	}
+
+	if q.Limit > 0 && len(matched) > q.Limit+1 {
+		matched = matched[:q.Limit+1]
+	}
+	return Finish(q, matched, total, get)
+}
+
+// sortName is the accessor name of the sort field; fields stored in the id
+// column, like an autoincrement created_at, order by id
+func (q Query) sortName() string {
+	if f := q.sortField(); f.Column != idField.Column {
+		return f.Name
+	}
+	return idField.Name
+}
+
+// order compares item against the sort value and id of another
+func order[T any](q Query, item T, value any, id int, get Accessor[T]) int {
+	if name := q.sortName(); name != idField.Name {
+		if c := compare(get(item, name), value); c != 0 {
+			return c
+		}
+	}
+	return compare(get(item, "id"), id)
+}
+
+func matches[T any](q Query, item T, get Accessor[T]) bool {
+	for _, f := range q.Filters {
+		c := compare(get(item, f.Field.Name), f.Value)
+		var ok bool
+		switch f.Op {
+		case Eq:
+			ok = c == 0
+		case Gt:
+			ok = c > 0
+		case Gte:
+			ok = c >= 0
+		case Lt:
+			ok = c < 0
+		case Lte:
+			ok = c <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func compare(a, b any) int {
+	switch a := a.(type) {
+	case int:
+		b, _ := b.(int)
+		return a - b
+	case float64:
+		b, _ := b.(float64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case string:
+		b, _ := b.(string)
+		return strings.Compare(a, b)
+	}
+	return 0
+}
+
+// Write responds with the page under key, the total count header and a Link
+// to the next page. The body is tagged with a weak ETag and a matching
+// If-None-Match gets 304 Not Modified
+func Write[T any](c *gin.Context, key string, page Page[T]) {
+	c.Header(TotalCountHeader, strconv.Itoa(page.Total))
+
+	body := gin.H{key: page.Items}
+	if page.Next != "" {
+		body["next_cursor"] = page.Next
+
+		next := *c.Request.URL
+		values := next.Query()
+		values.Set("cursor", page.Next)
+		next.RawQuery = values.Encode()
+		c.Header("Link", "<"+next.RequestURI()+`>; rel="next"`)
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("could not encode "+key, err))
+		return
+	}
+
+	tag := etag.Of(data)
+	c.Header("ETag", tag)
+	if match := c.GetHeader("If-None-Match"); match != "" && etag.Match(match, tag, true) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
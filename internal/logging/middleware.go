@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader is read from requests and always set on responses
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDMiddleware keeps the caller's X-Request-ID when it looks sane, otherwise
+// generates one, and stores it in the request context for logs and errors
+func RequestIDMiddleware(c *gin.Context) {
+	id := c.GetHeader(RequestIDHeader)
+	if !validRequestID(id) {
+		b := make([]byte, 16)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+
+	c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+	c.Header(RequestIDHeader, id)
+
+	c.Next()
+}
+
+// validRequestID accepts up to 128 characters of letters, digits and -_.:
+// so a caller can't inject anything odd into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// AccessLog logs one line per request. The query string is left out since
+// it's where clients tend to put things that shouldn't be logged
+func AccessLog(c *gin.Context) {
+	start := time.Now()
+
+	c.Next()
+
+	status := c.Writer.Status()
+	attrs := []any{
+		"method", c.Request.Method,
+		"path", c.Request.URL.Path,
+		"route", c.FullPath(),
+		"status", status,
+		"duration", time.Since(start),
+		"bytes", c.Writer.Size(),
+		"client_ip", c.ClientIP(),
+	}
+	if userID, ok := c.Get("user_id"); ok {
+		attrs = append(attrs, "user_id", userID)
+	}
+
+	level := slog.LevelInfo
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+
+	slog.Log(c.Request.Context(), level, "request", attrs...)
+}
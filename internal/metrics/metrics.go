@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// Logins counts login attempts by result: success, invalid or disabled
+	Logins = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logins_total",
+		Help: "Login attempts by result.",
+	}, []string{"result"})
+
+	// ResetEmails counts password reset links issued, one email each
+	ResetEmails = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "auth_reset_emails_total",
+		Help: "Password reset links issued.",
+	})
+
+	// JobsInFlight is how many background jobs are running right now
+	JobsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "background_jobs_in_flight",
+		Help: "Background jobs currently running.",
+	})
+
+	// JobRuns counts finished background job runs by worker and result
+	JobRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "background_job_runs_total",
+		Help: "Finished background job runs by worker and result.",
+	}, []string{"worker", "result"})
+)
+
+// Middleware records every request under its route template, never the raw
+// path, so ids in URLs don't create a series each
+func Middleware(c *gin.Context) {
+	start := time.Now()
+
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+
+	requests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+	requestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+}
+
+// Handler serves everything registered with the default registry
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// RegisterDB exports the connection pool stats of db. Call it once per pool
+func RegisterDB(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
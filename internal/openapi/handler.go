@@ -0,0 +1,34 @@
+package openapi
+
+import (
+	_ "embed"
+	"html"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed docs.html
+var docsPage string
+
+// SpecHandler serves the document returned by build, which runs on the first
+// request so every route is registered by then
+func SpecHandler(build func() *Document) gin.HandlerFunc {
+	doc := sync.OnceValue(build)
+
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc())
+	}
+}
+
+// DocsHandler serves a self-contained page that browses and tries out the
+// spec found at specURL
+func DocsHandler(specURL string) gin.HandlerFunc {
+	page := []byte(strings.ReplaceAll(docsPage, "{{SPEC}}", html.EscapeString(specURL)))
+
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+	}
+}
@@ -0,0 +1,404 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Operation documents one route. Request and Response are zero values of the
+// body types, or nil when the route takes or returns no JSON body
+type Operation struct {
+	Summary string
+	Tag     string
+	Auth    bool
+	Request any
+	// RequestType is the request media type, application/json when empty
+	RequestType string
+	Response    any
+	// Status is the success status, http.StatusOK when zero
+	Status int
+	// ContentType is the success media type, application/json when empty
+	ContentType string
+	Deprecated  bool
+	// Query lists the query string parameters
+	Query []Param
+	// Headers lists the request headers the route reads
+	Headers []Param
+	// ResponseHeaders lists the headers sent with a successful response
+	ResponseHeaders []Param
+	// Statuses lists the other statuses the route answers with. Those below
+	// 400 have no body; the rest are problems like any error
+	Statuses []int
+}
+
+// Param is a query string or header parameter, optional unless Required
+type Param struct {
+	Name        string
+	Description string
+	Required    bool
+	Schema      Schema
+}
+
+// Info describes the API as a whole
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// Schema is a JSON Schema object as used by OpenAPI 3.1
+type Schema map[string]any
+
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components components                      `json:"components"`
+}
+
+type components struct {
+	Schemas         map[string]Schema `json:"schemas"`
+	SecuritySchemes map[string]Schema `json:"securitySchemes"`
+}
+
+type operation struct {
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	OperationID string                `json:"operationId"`
+	Parameters  []parameter           `json:"parameters,omitempty"`
+	RequestBody *body                 `json:"requestBody,omitempty"`
+	Responses   map[string]response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+type parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required"`
+	Schema      Schema `json:"schema"`
+}
+
+type body struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Headers     map[string]header    `json:"headers,omitempty"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type header struct {
+	Description string `json:"description,omitempty"`
+	Schema      Schema `json:"schema"`
+}
+
+type mediaType struct {
+	Schema Schema `json:"schema"`
+}
+
+// Key identifies a route in an operations table, e.g. "GET /notes/:id"
+func Key(method, path string) string {
+	return method + " " + path
+}
+
+// Build documents every route describe knows about; routes it doesn't are
+// left out, which is what tests look for. Errors are described by the
+// problem type, served as problemType
+func Build(info Info, routes gin.RoutesInfo, describe func(method, path string) (Operation, bool), problem any, problemType string) *Document {
+	g := &generator{schemas: map[string]Schema{}}
+
+	doc := &Document{
+		OpenAPI: "3.1.0",
+		Info:    info,
+		Paths:   map[string]map[string]operation{},
+		Components: components{
+			Schemas: g.schemas,
+			SecuritySchemes: map[string]Schema{
+				"bearerAuth": {"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+
+	problemSchema := g.schema(reflect.TypeOf(problem))
+
+	for _, route := range routes {
+		op, ok := describe(route.Method, route.Path)
+		if !ok {
+			continue
+		}
+
+		path, params := convertPath(route.Path)
+		out := operation{
+			Summary:     op.Summary,
+			OperationID: operationID(route.Method, route.Path),
+			Parameters:  params,
+			Deprecated:  op.Deprecated,
+			Responses: map[string]response{
+				"default": {
+					Description: "error",
+					Content:     map[string]mediaType{problemType: {Schema: problemSchema}},
+				},
+			},
+		}
+		for _, p := range op.Query {
+			out.Parameters = append(out.Parameters, parameter{Name: p.Name, In: "query", Description: p.Description, Required: p.Required, Schema: p.Schema})
+		}
+		for _, p := range op.Headers {
+			out.Parameters = append(out.Parameters, parameter{Name: p.Name, In: "header", Description: p.Description, Required: p.Required, Schema: p.Schema})
+		}
+		if op.Tag != "" {
+			out.Tags = []string{op.Tag}
+		}
+		if op.Auth {
+			out.Security = []map[string][]string{{"bearerAuth": {}}}
+		}
+
+		if op.Request != nil {
+			requestType := op.RequestType
+			if requestType == "" {
+				requestType = "application/json"
+			}
+			out.RequestBody = &body{
+				Required: true,
+				Content:  map[string]mediaType{requestType: {Schema: g.schema(reflect.TypeOf(op.Request))}},
+			}
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := response{Description: http.StatusText(status)}
+		if op.Response != nil {
+			contentType := op.ContentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			success.Content = map[string]mediaType{contentType: {Schema: g.schema(reflect.TypeOf(op.Response))}}
+		}
+		for _, h := range op.ResponseHeaders {
+			if success.Headers == nil {
+				success.Headers = map[string]header{}
+			}
+			success.Headers[h.Name] = header{Description: h.Description, Schema: h.Schema}
+		}
+		out.Responses[strconv.Itoa(status)] = success
+
+		for _, s := range op.Statuses {
+			other := response{Description: http.StatusText(s)}
+			if s >= 400 {
+				other.Content = map[string]mediaType{problemType: {Schema: problemSchema}}
+			}
+			out.Responses[strconv.Itoa(s)] = other
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]operation{}
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = out
+	}
+
+	return doc
+}
+
+// convertPath turns gin's /notes/:id into /notes/{id} and lists its parameters
+func convertPath(path string) (string, []parameter) {
+	var params []parameter
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, ":") && !strings.HasPrefix(segment, "*") {
+			continue
+		}
+
+		name := segment[1:]
+		schema := Schema{"type": "string"}
+		if name == "id" {
+			schema = Schema{"type": "integer"}
+		}
+		params = append(params, parameter{Name: name, In: "path", Required: true, Schema: schema})
+		segments[i] = "{" + name + "}"
+	}
+
+	return strings.Join(segments, "/"), params
+}
+
+// operationID derives a stable camelCase ID such as deleteNotesById
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, segment := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '-' }) {
+		if strings.HasPrefix(segment, ":") {
+			segment = "by" + strings.ToUpper(segment[1:2]) + segment[2:]
+		}
+		id += strings.ToUpper(segment[:1]) + segment[1:]
+	}
+	return id
+}
+
+type generator struct {
+	schemas map[string]Schema
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// schema describes t, adding named struct types to the components and
+// returning a $ref to them
+func (g *generator) schema(t reflect.Type) Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return Schema{"type": "string", "format": "date-time"}
+	}
+
+	// custom encodings in this API (durations and the like) are all strings
+	if t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) {
+		return Schema{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := schemaName(t)
+		if _, ok := g.schemas[name]; !ok {
+			// reserve the name first so recursive types terminate
+			g.schemas[name] = Schema{}
+			g.schemas[name] = g.object(t)
+		}
+		return Schema{"$ref": "#/components/schemas/" + name}
+	}
+
+	return Schema{}
+}
+
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func (g *generator) object(t reflect.Type) Schema {
+	properties := map[string]Schema{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+
+		// embedded structs without a name flatten into the parent
+		if f.Anonymous && name == "" {
+			embedded := g.object(f.Type)
+			for k, v := range embedded["properties"].(map[string]Schema) {
+				properties[k] = v
+			}
+			if r, ok := embedded["required"].([]string); ok {
+				required = append(required, r...)
+			}
+			continue
+		}
+
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		s := g.schema(f.Type)
+		if applyBinding(s, f.Tag.Get("binding")) {
+			required = append(required, name)
+		}
+		// the server sets these, whatever a request body says
+		if f.Tag.Get("openapi") == "readonly" {
+			s["readOnly"] = true
+		}
+		properties[name] = s
+	}
+
+	out := Schema{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		out["required"] = required
+	}
+	return out
+}
+
+// applyBinding copies the validation rules in a binding tag onto s and
+// reports whether the field is required
+func applyBinding(s Schema, tag string) bool {
+	if tag == "" {
+		return false
+	}
+
+	required := false
+	isString := s["type"] == "string"
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		n, _ := strconv.ParseFloat(param, 64)
+
+		switch name {
+		case "required":
+			required = true
+		case "max":
+			if isString {
+				s["maxLength"] = n
+			} else {
+				s["maximum"] = n
+			}
+		case "min":
+			if isString {
+				s["minLength"] = n
+			} else {
+				s["minimum"] = n
+			}
+		case "gt":
+			s["exclusiveMinimum"] = n
+		case "gte":
+			s["minimum"] = n
+		case "email":
+			s["format"] = "email"
+		case "rfc3339":
+			s["format"] = "date-time"
+		case "currency":
+			s["pattern"] = "^[A-Z]{3}$"
+		}
+	}
+
+	return required
+}
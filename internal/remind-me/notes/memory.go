@@ -0,0 +1,23 @@
+package notes
+
+import (
+	"context"
+	"time"
+
+	"github.com/z-sk1/signin-api/internal/resource"
+)
+
+type memoryRepository struct {
+	*resource.MemoryStore[Note, *Note]
+}
+
+// NewMemoryRepository returns a Repository backed by process memory, used in tests
+func NewMemoryRepository() Repository {
+	return memoryRepository{resource.NewMemoryStore[Note](columns)}
+}
+
+// Create stamps created_at, which the database would default
+func (r memoryRepository) Create(ctx context.Context, note *Note) error {
+	note.CreatedAt = time.Now()
+	return r.MemoryStore.Create(ctx, note)
+}
@@ -2,181 +2,39 @@ package notes
 
 import (
 	"net/http"
-
 	"time"
 
-	"fmt"
-
-	"strconv"
-
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/z-sk1/signin-api/internal/auth"
-	"github.com/z-sk1/signin-api/internal/db"
+	"github.com/z-sk1/signin-api/internal/apierror"
+	"github.com/z-sk1/signin-api/internal/resource"
 )
 
-type Note struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
+// Handler serves the shared resource endpoints plus the note count
+type Handler struct {
+	*resource.Handler[Note, *Note]
+	Repo Repository
 }
 
-func CreateNote(c *gin.Context) {
-	username := c.GetString("username")
-	var note Note
-
-	if err := c.BindJSON(&note); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
-		return
-	}
-
-	// find user_id from username
-	var userID int
-	err := db.DB.QueryRow("SELECT id FROM users WHERE username = $1", username).Scan(&userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not find user"})
-		return
-	}
-
-	_, err = db.DB.Exec("INSERT INTO notes(username, title, content, user_id) VALUES ($1, $2, $3, $4)", username, note.Title, note.Content, userID)
-	if err != nil {
-		fmt.Println("Error inserting note:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save note"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "note created succesfully"})
-}
-
-func GetAllNotes(c *gin.Context) {
-	username := c.GetString("username")
-
-	// find user id
-	var userID int
-	err := db.DB.QueryRow("SELECT id FROM users WHERE username = $1", username).Scan(&userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not find user"})
-		return
-	}
-
-	// get all notes for user
-	rows, err := db.DB.Query("SELECT id, title, content, created_at FROM notes WHERE user_id = $1", userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not find notes"})
-		return
-	}
-	defer rows.Close()
-
-	var notes []Note
-	for rows.Next() {
-		var note Note
-		if err := rows.Scan(&note.ID, &note.Title, &note.Content, &note.CreatedAt); err != nil {
-			fmt.Println("Error reading notes:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not read notes"})
-			return
-		}
-		note.Username = username
-		notes = append(notes, note)
-	}
-
-	c.JSON(http.StatusOK, gin.H{"notes": notes})
-}
-
-func GetNoteCount(c *gin.Context) {
-	username := c.GetString("username")
-
-	// find user id
-	var userID int
-	err := db.DB.QueryRow("SELECT id FROM users WHERE username = $1", username).Scan(&userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not find user"})
-		return
-	}
-
-	var total int
-	err = db.DB.QueryRow("SELECT COUNT(*) AS total FROM notes WHERE user_id = $1", userID).Scan(&total)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not read total notes"})
-		return 
+func NewHandler(repo Repository) *Handler {
+	return &Handler{
+		Handler: &resource.Handler[Note, *Note]{Name: "note", Plural: "notes", Store: repo, Spec: ListSpec},
+		Repo:    repo,
 	}
-
-	c.JSON(http.StatusInternalServerError, gin.H{"total": total})
 }
 
-func DeleteNote(c *gin.Context) {
-	tokenStr := c.GetHeader("Authorization")
-	if tokenStr == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
-		c.Abort()
-		return
-	}
-
-	if len(tokenStr) > 7 && tokenStr[:7] == "Bearer " {
-		tokenStr = tokenStr[7:]
-	}
-
-	// Parse JWT
-	claims := &auth.Claims{} // assuming you have your Claims struct in package "auth"
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return auth.JwtKey, nil
-	})
-
-	if err != nil || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-		return
-	}
-
-	username := claims.Username
-
-	idStr := c.Param("id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note id"})
-		return
-	}
-
-	_, err = db.DB.Exec("DELETE FROM notes WHERE id = $1 AND username = $2", id, username)
-	if err != nil {
-		fmt.Println("Error deleting note:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not delete note"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "note deleted succesfully"})
+type Note struct {
+	resource.Owned
+	Title     string    `json:"title" binding:"required,max=200"`
+	Content   string    `json:"content" binding:"max=10000"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
-func UpdateNote(c *gin.Context) {
-	username := c.GetString("username")
-	idStr := c.Param("id")
-	id, err := strconv.Atoi(idStr)
+func (h *Handler) GetNoteCount(c *gin.Context) {
+	total, err := h.Repo.Count(c.Request.Context(), c.GetInt("user_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note id"})
-		return
-	}
-
-	var note struct {
-		Title   string `json:"title"`
-		Content string `json:"content"`
-	}
-	if err := c.BindJSON(&note); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
-		return
-	}
-
-	// make sure the note belongs to the user
-	res, err := db.DB.Exec("UPDATE notes SET title = $1, content = $2 WHERE id = $3 AND user_id = (SELECT id FROM users WHERE username = $4)", note.Title, note.Content, id, username)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update note"})
-		return
-	}
-
-	rowsAffected, _ := res.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "note not found"})
+		apierror.Abort(c, apierror.Internal("could not read total notes", err))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "note updated successfully"})
+	c.JSON(http.StatusOK, gin.H{"total": total})
 }
@@ -0,0 +1,43 @@
+package notes
+
+import (
+	"context"
+
+	"github.com/z-sk1/signin-api/internal/db"
+	"github.com/z-sk1/signin-api/internal/listquery"
+	"github.com/z-sk1/signin-api/internal/resource"
+)
+
+// Repository stores notes; every method is scoped to the owning user
+type Repository interface {
+	resource.Store[Note]
+	Count(ctx context.Context, userID int) (int, error)
+}
+
+// ListSpec is what notes can be sorted and filtered by; notes are created in
+// id order so created_at sorts by id
+var ListSpec = listquery.Spec{Fields: []listquery.Field{
+	{Name: "created_at", Column: "id", Kind: listquery.Time, Sort: true},
+	{Name: "title", Column: "title", Kind: listquery.String, Sort: true, Filter: true},
+}}
+
+var columns = resource.Columns[Note]{
+	Table:    "notes",
+	Writable: []string{"title", "content"},
+	Values:   func(n *Note) []any { return []any{n.Title, n.Content} },
+	Read:     []string{"title", "content", "created_at"},
+	Dest:     func(n *Note) []any { return []any{&n.Title, &n.Content, &n.CreatedAt} },
+	Field: func(n Note, name string) any {
+		switch name {
+		case "id":
+			return n.ID
+		case "title":
+			return n.Title
+		}
+		return nil
+	},
+}
+
+func NewSQLRepository(conn *db.Conn) Repository {
+	return resource.NewSQLStore[Note](conn, columns)
+}
@@ -0,0 +1,23 @@
+package reminders
+
+import (
+	"context"
+	"time"
+
+	"github.com/z-sk1/signin-api/internal/resource"
+)
+
+type memoryRepository struct {
+	*resource.MemoryStore[Reminder, *Reminder]
+}
+
+// NewMemoryRepository returns a Repository backed by process memory, used in tests
+func NewMemoryRepository() Repository {
+	return memoryRepository{resource.NewMemoryStore[Reminder](columns)}
+}
+
+// Create stamps created_at, which the database would default
+func (r memoryRepository) Create(ctx context.Context, reminder *Reminder) error {
+	reminder.CreatedAt = time.Now()
+	return r.MemoryStore.Create(ctx, reminder)
+}
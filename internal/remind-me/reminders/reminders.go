@@ -2,195 +2,49 @@ package reminders
 
 import (
 	"net/http"
-
 	"time"
 
-	"fmt"
-
-	"strconv"
-
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/z-sk1/signin-api/internal/auth"
-	"github.com/z-sk1/signin-api/internal/db"
+	"github.com/z-sk1/signin-api/internal/apierror"
+	"github.com/z-sk1/signin-api/internal/listquery"
+	"github.com/z-sk1/signin-api/internal/resource"
 )
 
-type Reminder struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	Due       string    `json:"due"`
-	CreatedAt time.Time `json:"created_at"`
+// Handler serves the shared resource endpoints plus the reminder count
+type Handler struct {
+	*resource.Handler[Reminder, *Reminder]
+	Repo Repository
 }
 
-func CreateReminder(c *gin.Context) {
-	username := c.GetString("username")
-	var reminder Reminder
-
-	if err := c.BindJSON(&reminder); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
-		return
-	}
-
-	// find user_id from username
-	var userID int
-	err := db.DB.QueryRow("SELECT id FROM users WHERE username = $1", username).Scan(&userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not find users"})
-		return
-	}
-
-	dueTime, err := time.Parse(time.RFC3339, reminder.Due)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid due date"})
-		return
-	}
-
-	_, err = db.DB.Exec("INSERT INTO reminders(username, title, content, due, user_id) VALUES ($1, $2, $3, $4, $5)", username, reminder.Title, reminder.Content, dueTime, userID)
-	if err != nil {
-		fmt.Println("Error inserting reminder:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save reminder"})
-		return
+func NewHandler(repo Repository) *Handler {
+	return &Handler{
+		Handler: &resource.Handler[Reminder, *Reminder]{
+			Name:   "reminder",
+			Plural: "reminders",
+			Store:  repo,
+			Spec:   ListSpec,
+			Prepare: func(r *Reminder) {
+				r.Due = listquery.NormalizeTime(r.Due)
+			},
+		},
+		Repo: repo,
 	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "reminder created succesfully"})
 }
 
-func GetAllReminders(c *gin.Context) {
-	username := c.GetString("username")
-
-	// find user id
-	var userID int
-	err := db.DB.QueryRow("SELECT id FROM users WHERE username = $1", username).Scan(&userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not find user"})
-		return
-	}
-
-	// get all reminders for user
-	rows, err := db.DB.Query("SELECT id, title, content, due, created_at FROM reminders WHERE user_id = $1", userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not find reminders"})
-		return
-	}
-	defer rows.Close()
-
-	var reminders []Reminder
-	for rows.Next() {
-		var reminder Reminder
-		if err := rows.Scan(&reminder.ID, &reminder.Title, &reminder.Content, &reminder.Due, &reminder.CreatedAt); err != nil {
-			fmt.Println("Error reading reminders:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not read reminders"})
-			return
-		}
-		reminder.Username = username
-		reminders = append(reminders, reminder)
-	}
-
-	c.JSON(http.StatusOK, gin.H{"reminders": reminders})
+type Reminder struct {
+	resource.Owned
+	Title     string    `json:"title" binding:"required,max=200"`
+	Content   string    `json:"content" binding:"max=10000"`
+	Due       string    `json:"due" binding:"required,rfc3339"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
-func GetReminderCount(c *gin.Context) {
-	username := c.GetString("username")
-
-	// find user id 
-	var userID int 
-	err := db.DB.QueryRow("SELECT id FROM users WHERE username = $1", username).Scan(&userID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not find user"})
-		return
-	}
-
-	var total int
-	err = db.DB.QueryRow("SELECT COUNT(*) AS total FROM reminders WHERE user_id = $1", userID).Scan(&total)
+func (h *Handler) GetReminderCount(c *gin.Context) {
+	total, err := h.Repo.Count(c.Request.Context(), c.GetInt("user_id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not get reminder count"})
+		apierror.Abort(c, apierror.Internal("could not get reminder count", err))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"total": total})
 }
-
-func DeleteReminder(c *gin.Context) {
-	tokenStr := c.GetHeader("Authorization")
-
-	if tokenStr == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "missing token"})
-		c.Abort()
-		return
-	}
-
-	if len(tokenStr) > 7 && tokenStr[:7] == "Bearer " {
-		tokenStr = tokenStr[7:]
-	}
-
-	// Parse JWT
-	claims := &auth.Claims{}
-	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return auth.JwtKey, nil
-	})
-
-	if err != nil || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-		return
-	}
-
-	username := claims.Username
-
-	idStr := c.Param("id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reminder id"})
-		return
-	}
-
-	_, err = db.DB.Exec("DELETE FROM reminders WHERE id = $1 AND username = $2", id, username)
-	if err != nil {
-		fmt.Println("Error deleting reminder:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not delete reminder"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "reminder deleted succesfully"})
-}
-
-func UpdateReminder(c *gin.Context) {
-	username := c.GetString("username")
-	idStr := c.Param("id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reminder id"})
-		return
-	}
-
-	var reminder struct {
-		Title   string `json:"title"`
-		Content string `json:"content"`
-		Due     string `json:"due"`
-	}
-	if err := c.BindJSON(&reminder); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
-		return
-	}
-
-	dueTime, err := time.Parse(time.RFC3339, reminder.Due)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid due date"})
-		return
-	}
-
-	res, err := db.DB.Exec("UPDATE reminders SET title = $1, content = $2, due = $3 WHERE id = $4 AND user_id = (SELECT id FROM users WHERE username = $5)", reminder.Title, reminder.Content, dueTime, id, username)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update reminder"})
-		return
-	}
-
-	rowsAffected, _ := res.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "reminder not found"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "reminder updated successfully"})
-}
@@ -0,0 +1,46 @@
+package reminders
+
+import (
+	"context"
+
+	"github.com/z-sk1/signin-api/internal/db"
+	"github.com/z-sk1/signin-api/internal/listquery"
+	"github.com/z-sk1/signin-api/internal/resource"
+)
+
+// Repository stores reminders; every method is scoped to the owning user
+type Repository interface {
+	resource.Store[Reminder]
+	Count(ctx context.Context, userID int) (int, error)
+}
+
+// ListSpec is what reminders can be sorted and filtered by; reminders are
+// created in id order so created_at sorts by id
+var ListSpec = listquery.Spec{Fields: []listquery.Field{
+	{Name: "due", Column: "due", Kind: listquery.Time, Sort: true, Filter: true},
+	{Name: "created_at", Column: "id", Kind: listquery.Time, Sort: true},
+	{Name: "title", Column: "title", Kind: listquery.String, Sort: true, Filter: true},
+}}
+
+var columns = resource.Columns[Reminder]{
+	Table:    "reminders",
+	Writable: []string{"title", "content", "due"},
+	Values:   func(r *Reminder) []any { return []any{r.Title, r.Content, r.Due} },
+	Read:     []string{"title", "content", "due", "created_at"},
+	Dest:     func(r *Reminder) []any { return []any{&r.Title, &r.Content, &r.Due, &r.CreatedAt} },
+	Field: func(r Reminder, name string) any {
+		switch name {
+		case "id":
+			return r.ID
+		case "due":
+			return r.Due
+		case "title":
+			return r.Title
+		}
+		return nil
+	},
+}
+
+func NewSQLRepository(conn *db.Conn) Repository {
+	return resource.NewSQLStore[Reminder](conn, columns)
+}
@@ -0,0 +1,245 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/z-sk1/signin-api/internal/apierror"
+)
+
+// batch modes
+const (
+	// AllOrNothing rolls the whole batch back when any operation fails
+	AllOrNothing = "all_or_nothing"
+	// PerItem commits the operations that succeed and reports each failure
+	PerItem = "per_item"
+)
+
+// Op is one operation of a batch
+type Op struct {
+	Method string `json:"method" binding:"required,oneof=create update delete"`
+	// Resource is the plural the resource is served under, e.g. "notes"
+	Resource string `json:"resource" binding:"required"`
+	// ID is the item to update or delete
+	ID int `json:"id"`
+	// Version makes an update or delete conditional, as If-Match does
+	Version int `json:"version"`
+	// Body is the item to create, or its replacement for an update
+	Body map[string]any `json:"body"`
+}
+
+type BatchRequest struct {
+	// Mode is AllOrNothing, the default, or PerItem
+	Mode       string `json:"mode" binding:"omitempty,oneof=all_or_nothing per_item"`
+	Operations []Op   `json:"operations" binding:"required,min=1,dive"`
+}
+
+// BatchResult is the outcome of one operation: the item created or updated,
+// or the error the operation's own route would have responded with
+type BatchResult struct {
+	Status int               `json:"status"`
+	Item   any               `json:"item,omitempty"`
+	Error  *apierror.Problem `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// Batchable is a resource a batch can write to; every Handler is one
+type Batchable interface {
+	Apply(ctx context.Context, user Owned, op Op) (any, *apierror.Error)
+}
+
+// Atomic runs fn so the store writes made with the context it's given either
+// all happen or, when fn returns an error, none do. db.Conn.InTx is one
+type Atomic func(ctx context.Context, fn func(ctx context.Context) error) error
+
+// Snapshotter is a store whose contents can be saved and put back
+type Snapshotter interface {
+	Snapshot() (restore func())
+}
+
+// MemoryAtomic makes batches against memory stores atomic by restoring every
+// store when one fails. Batches run one at a time, but a write made outside
+// a batch while one is failing may be lost, which is fine for tests
+func MemoryAtomic(stores ...Snapshotter) Atomic {
+	var mu sync.Mutex
+	return func(ctx context.Context, fn func(ctx context.Context) error) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		restores := make([]func(), len(stores))
+		for i, s := range stores {
+			restores[i] = s.Snapshot()
+		}
+
+		err := fn(ctx)
+		if err != nil {
+			for _, restore := range restores {
+				restore()
+			}
+		}
+		return err
+	}
+}
+
+// Batch runs many operations across resources in one transaction
+type Batch struct {
+	// Resources are the batchable resources by plural
+	Resources map[string]Batchable
+	Atomic    Atomic
+	// MaxOperations limits the operations in one request
+	MaxOperations int
+}
+
+// Handle serves POST /batch. PerItem batches run in one transaction too, so
+// a server failure rolls back every operation whatever the mode
+func (b *Batch) Handle(c *gin.Context) {
+	var req BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, apierror.Bind(err))
+		return
+	}
+	if len(req.Operations) > b.MaxOperations {
+		apierror.Abort(c, apierror.InvalidField("operations", "max", fmt.Sprintf("must have at most %d operations", b.MaxOperations)))
+		return
+	}
+
+	resources := make([]Batchable, len(req.Operations))
+	for i, op := range req.Operations {
+		r, ok := b.Resources[op.Resource]
+		if !ok {
+			names := slices.Sorted(maps.Keys(b.Resources))
+			apierror.Abort(c, apierror.InvalidField(fmt.Sprintf("operations[%d].resource", i), "oneof", fmt.Sprintf("must be one of %v", names)))
+			return
+		}
+		resources[i] = r
+	}
+
+	user := owner(c, 0)
+	var results []BatchResult
+	err := b.Atomic(c.Request.Context(), func(ctx context.Context) error {
+		// a transaction may be retried, so start over each time
+		results = make([]BatchResult, len(req.Operations))
+
+		for i, op := range req.Operations {
+			item, apiErr := resources[i].Apply(ctx, user, op)
+			switch {
+			case apiErr == nil && op.Method == "create":
+				results[i] = BatchResult{Status: http.StatusCreated, Item: item}
+			case apiErr == nil:
+				results[i] = BatchResult{Status: http.StatusOK, Item: item}
+			case apiErr.Status >= http.StatusInternalServerError:
+				return apiErr
+			case req.Mode == PerItem:
+				p := apiErr.Problem()
+				results[i] = BatchResult{Status: apiErr.Status, Error: &p}
+			default:
+				return at(i, apiErr)
+			}
+		}
+		return nil
+	})
+
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		apierror.Abort(c, apiErr)
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.Internal("batch failed", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, BatchResponse{Results: results})
+}
+
+// at reports the failure of operation i as the failure of the whole batch
+func at(i int, err *apierror.Error) *apierror.Error {
+	out := *err
+	out.Detail = fmt.Sprintf("operation %d failed, so none were applied: %s", i, err.Detail)
+	out.Fields = make([]apierror.FieldError, len(err.Fields))
+	for j, f := range err.Fields {
+		f.Field = fmt.Sprintf("operations[%d].%s", i, f.Field)
+		out.Fields[j] = f
+	}
+	return &out
+}
+
+// Apply runs one batch operation as user, with the same rules as the
+// resource's own routes
+func (h *Handler[T, P]) Apply(ctx context.Context, user Owned, op Op) (any, *apierror.Error) {
+	if op.Method != "create" {
+		if op.ID == 0 {
+			return nil, apierror.InvalidField("id", "required", "id is required to "+op.Method+" a "+h.Name)
+		}
+		if op.Version == 0 && h.RequireIfMatch {
+			return nil, apierror.New(http.StatusPreconditionRequired, apierror.CodeIfMatchRequired, "send the "+h.Name+"'s version")
+		}
+	}
+
+	switch op.Method {
+	case "create":
+		item, apiErr := h.decode(op.Body)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		h.own(item, Owned{UserID: user.UserID, Username: user.Username})
+
+		if err := h.Store.Create(ctx, item); err != nil {
+			return nil, apierror.Internal("failed to save "+h.Name, err)
+		}
+		return item, nil
+
+	case "update":
+		item, apiErr := h.decode(op.Body)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		h.own(item, Owned{ID: op.ID, UserID: user.UserID, Username: user.Username})
+		P(item).owned().Version = op.Version
+
+		if err := h.Store.Update(ctx, item); err != nil {
+			return nil, h.failure(err, "failed to update")
+		}
+		saved, err := h.Store.Get(ctx, user.UserID, op.ID)
+		if err != nil {
+			return nil, h.failure(err, "could not read")
+		}
+		return saved, nil
+
+	default:
+		if err := h.Store.Delete(ctx, user.UserID, op.ID, op.Version); err != nil {
+			return nil, h.failure(err, "could not delete")
+		}
+		return nil, nil
+	}
+}
+
+// decode binds and validates an operation's body as a request body would be
+func (h *Handler[T, P]) decode(body map[string]any) (*T, *apierror.Error) {
+	if body == nil {
+		return nil, apierror.InvalidField("body", "required", "body is required")
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, apierror.Bind(err)
+	}
+	item := new(T)
+	if err := json.Unmarshal(data, item); err != nil {
+		return nil, apierror.Bind(err)
+	}
+	if err := binding.Validator.ValidateStruct(item); err != nil {
+		return nil, apierror.Bind(err)
+	}
+	return item, nil
+}
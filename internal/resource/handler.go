@@ -0,0 +1,320 @@
+package resource
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/z-sk1/signin-api/internal/apierror"
+	"github.com/z-sk1/signin-api/internal/db"
+	"github.com/z-sk1/signin-api/internal/etag"
+	"github.com/z-sk1/signin-api/internal/listquery"
+)
+
+// Handler serves a resource's endpoints to signed-in users
+type Handler[T any, P Model[T]] struct {
+	// Name is the singular used in messages, e.g. "note"
+	Name string
+	// Plural names the routes and the list in responses, e.g. "notes"
+	Plural string
+	Store  Store[T]
+	Spec   listquery.Spec
+	// Prepare normalises an item once it's bound, before it's saved
+	Prepare func(item *T)
+	// RequireIfMatch rejects writes that don't say which version they change
+	RequireIfMatch bool
+}
+
+// Routes registers the resource under /<Plural> on an authenticated group
+func (h *Handler[T, P]) Routes(g *gin.RouterGroup) {
+	g.POST("/"+h.Plural, h.Create)
+	g.GET("/"+h.Plural, h.List)
+	g.GET("/"+h.Plural+"/:id", h.Get)
+	g.PUT("/"+h.Plural+"/:id", h.Update)
+	g.PATCH("/"+h.Plural+"/:id", h.Patch)
+	g.DELETE("/"+h.Plural+"/:id", h.Delete)
+}
+
+// Create responds with the item as stored, so its id and version are known
+// without reading it back
+func (h *Handler[T, P]) Create(c *gin.Context) {
+	item := new(T)
+	if err := c.ShouldBindJSON(item); err != nil {
+		apierror.Abort(c, apierror.Bind(err))
+		return
+	}
+	h.own(item, owner(c, 0))
+
+	if err := h.Store.Create(c.Request.Context(), item); err != nil {
+		apierror.Abort(c, apierror.Internal("failed to save "+h.Name, err))
+		return
+	}
+
+	o := P(item).owned()
+	c.Header("Location", c.Request.URL.Path+"/"+strconv.Itoa(o.ID))
+	c.Header("ETag", etag.Version(o.Version))
+	c.JSON(http.StatusCreated, item)
+}
+
+func (h *Handler[T, P]) List(c *gin.Context) {
+	q, apiErr := h.Spec.Parse(c.Request.URL.Query())
+	if apiErr != nil {
+		apierror.Abort(c, apiErr)
+		return
+	}
+
+	page, err := h.Store.List(c.Request.Context(), c.GetInt("user_id"), q)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("could not read "+h.Plural, err))
+		return
+	}
+
+	listquery.Write(c, h.Plural, page)
+}
+
+func (h *Handler[T, P]) Get(c *gin.Context) {
+	id, ok := h.id(c)
+	if !ok {
+		return
+	}
+
+	item, ok := h.load(c, id)
+	if !ok {
+		return
+	}
+
+	tag := etag.Version(P(item).owned().Version)
+	c.Header("ETag", tag)
+	if match := c.GetHeader("If-None-Match"); match != "" && etag.Match(match, tag, true) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// Update replaces every writable field of an item and responds with the result
+func (h *Handler[T, P]) Update(c *gin.Context) {
+	id, ok := h.id(c)
+	if !ok {
+		return
+	}
+
+	item := new(T)
+	if err := c.ShouldBindJSON(item); err != nil {
+		apierror.Abort(c, apierror.Bind(err))
+		return
+	}
+
+	current, ok := h.precondition(c, id)
+	if !ok {
+		return
+	}
+	h.own(item, owner(c, id))
+	if current != nil {
+		P(item).owned().Version = P(current).owned().Version
+	}
+
+	h.save(c, item)
+}
+
+// Patch applies a JSON Merge Patch (RFC 7396), changing only the fields the
+// body names, and responds with the result. The patched item is validated as a
+// whole, like a PUT
+func (h *Handler[T, P]) Patch(c *gin.Context) {
+	id, ok := h.id(c)
+	if !ok {
+		return
+	}
+
+	var patch map[string]any
+	err := json.NewDecoder(c.Request.Body).Decode(&patch)
+	if errors.Is(err, io.EOF) || (err == nil && patch == nil) {
+		apierror.Abort(c, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "body must be a JSON object"))
+		return
+	} else if err != nil {
+		apierror.Abort(c, apierror.Bind(err))
+		return
+	}
+
+	current, ok := h.precondition(c, id)
+	if !ok {
+		return
+	}
+	if current == nil {
+		if current, ok = h.load(c, id); !ok {
+			return
+		}
+	}
+
+	doc, err := toMap(current)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("failed to patch "+h.Name, err))
+		return
+	}
+	data, err := json.Marshal(mergePatch(doc, patch))
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("failed to patch "+h.Name, err))
+		return
+	}
+
+	item := new(T)
+	if err := json.Unmarshal(data, item); err != nil {
+		apierror.Abort(c, apierror.Bind(err))
+		return
+	}
+	if err := binding.Validator.ValidateStruct(item); err != nil {
+		apierror.Abort(c, apierror.Bind(err))
+		return
+	}
+	h.own(item, owner(c, id))
+
+	// the patch was applied to this version, so a concurrent write fails it
+	P(item).owned().Version = P(current).owned().Version
+
+	h.save(c, item)
+}
+
+func (h *Handler[T, P]) Delete(c *gin.Context) {
+	id, ok := h.id(c)
+	if !ok {
+		return
+	}
+
+	current, ok := h.precondition(c, id)
+	if !ok {
+		return
+	}
+	version := 0
+	if current != nil {
+		version = P(current).owned().Version
+	}
+
+	if err := h.Store.Delete(c.Request.Context(), c.GetInt("user_id"), id, version); err != nil {
+		apierror.Abort(c, h.failure(err, "could not delete"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": h.Name + " deleted successfully"})
+}
+
+// save updates item and responds with it as stored, including the columns
+// the database fills in
+func (h *Handler[T, P]) save(c *gin.Context, item *T) {
+	if err := h.Store.Update(c.Request.Context(), item); err != nil {
+		apierror.Abort(c, h.failure(err, "failed to update"))
+		return
+	}
+
+	saved, ok := h.load(c, P(item).owned().ID)
+	if !ok {
+		return
+	}
+
+	c.Header("ETag", etag.Version(P(saved).owned().Version))
+	c.JSON(http.StatusOK, saved)
+}
+
+// precondition checks If-Match before a write. It returns the current item
+// when the header was given, whose version the write is then made against,
+// and nil when it wasn't
+func (h *Handler[T, P]) precondition(c *gin.Context, id int) (*T, bool) {
+	match := c.GetHeader("If-Match")
+	if match == "" {
+		if h.RequireIfMatch {
+			apierror.Abort(c, apierror.New(http.StatusPreconditionRequired, apierror.CodeIfMatchRequired, "send the "+h.Name+"'s ETag in If-Match"))
+			return nil, false
+		}
+		return nil, true
+	}
+
+	current, ok := h.load(c, id)
+	if !ok {
+		return nil, false
+	}
+	if !etag.Match(match, etag.Version(P(current).owned().Version), false) {
+		apierror.Abort(c, h.conflict())
+		return nil, false
+	}
+	return current, true
+}
+
+func (h *Handler[T, P]) conflict() *apierror.Error {
+	return apierror.New(http.StatusPreconditionFailed, apierror.CodeVersionMismatch, h.Name+" has changed; fetch it again and retry")
+}
+
+func (h *Handler[T, P]) load(c *gin.Context, id int) (*T, bool) {
+	item, err := h.Store.Get(c.Request.Context(), c.GetInt("user_id"), id)
+	if err != nil {
+		apierror.Abort(c, h.failure(err, "could not read"))
+		return nil, false
+	}
+	return item, true
+}
+
+// failure turns a store error into a response, naming what failed when it
+// was the server's fault
+func (h *Handler[T, P]) failure(err error, action string) *apierror.Error {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return apierror.NotFound(h.Name + " not found")
+	case errors.Is(err, db.ErrConflict):
+		return h.conflict()
+	}
+	return apierror.Internal(action+" "+h.Name, err)
+}
+
+// own sets the fields the server controls, whatever the body said
+func (h *Handler[T, P]) own(item *T, o Owned) {
+	*P(item).owned() = o
+	if h.Prepare != nil {
+		h.Prepare(item)
+	}
+}
+
+// owner is the signed-in user as the owner of item id
+func owner(c *gin.Context, id int) Owned {
+	return Owned{ID: id, UserID: c.GetInt("user_id"), Username: c.GetString("username")}
+}
+
+func (h *Handler[T, P]) id(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, apierror.InvalidField("id", "invalid", "invalid "+h.Name+" id"))
+		return 0, false
+	}
+	return id, true
+}
+
+func toMap(v any) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	return m, json.Unmarshal(data, &m)
+}
+
+// mergePatch applies patch to target as RFC 7396 describes: null removes a
+// member, objects merge recursively and anything else replaces
+func mergePatch(target, patch map[string]any) map[string]any {
+	if target == nil {
+		target = map[string]any{}
+	}
+	for k, v := range patch {
+		switch v := v.(type) {
+		case nil:
+			delete(target, k)
+		case map[string]any:
+			sub, _ := target[k].(map[string]any)
+			target[k] = mergePatch(sub, v)
+		default:
+			target[k] = v
+		}
+	}
+	return target
+}
@@ -0,0 +1,145 @@
+package resource
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/z-sk1/signin-api/internal/db"
+	"github.com/z-sk1/signin-api/internal/listquery"
+)
+
+// MemoryStore is a Store backed by process memory, used in tests
+type MemoryStore[T any, P Model[T]] struct {
+	cols Columns[T]
+	// writable maps each of cols.Writable to its index in cols.Read
+	writable []int
+
+	mu     sync.Mutex
+	nextID int
+	items  []T
+}
+
+func NewMemoryStore[T any, P Model[T]](cols Columns[T]) *MemoryStore[T, P] {
+	s := &MemoryStore[T, P]{cols: cols, nextID: 1}
+	for _, col := range cols.Writable {
+		s.writable = append(s.writable, slices.Index(cols.Read, col))
+	}
+	return s
+}
+
+func (s *MemoryStore[T, P]) Create(ctx context.Context, item *T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o := P(item).owned()
+	o.ID, o.Version = s.nextID, 1
+	s.nextID++
+	s.items = append(s.items, *item)
+
+	return nil
+}
+
+func (s *MemoryStore[T, P]) Get(ctx context.Context, userID, id int) (*T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(userID, id)
+	if i < 0 {
+		return nil, db.ErrNotFound
+	}
+	item := s.items[i]
+	return &item, nil
+}
+
+func (s *MemoryStore[T, P]) List(ctx context.Context, userID int, q listquery.Query) (listquery.Page[T], error) {
+	return listquery.Apply(q, s.Owned(userID), s.cols.Field), nil
+}
+
+func (s *MemoryStore[T, P]) Count(ctx context.Context, userID int) (int, error) {
+	return len(s.Owned(userID)), nil
+}
+
+// Owned returns a copy of every item userID owns, in id order
+func (s *MemoryStore[T, P]) Owned(userID int) []T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var items []T
+	for _, item := range s.items {
+		if P(&item).owned().UserID == userID {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Update copies the writable columns, leaving those a database would fill in
+// as they were
+func (s *MemoryStore[T, P]) Update(ctx context.Context, item *T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o := P(item).owned()
+	i, err := s.find(o.UserID, o.ID, o.Version)
+	if err != nil {
+		return err
+	}
+
+	values := s.cols.Values(item)
+	dest := s.cols.Dest(&s.items[i])
+	for j, k := range s.writable {
+		reflect.ValueOf(dest[k]).Elem().Set(reflect.ValueOf(values[j]))
+	}
+	P(&s.items[i]).owned().Version++
+	return nil
+}
+
+func (s *MemoryStore[T, P]) Delete(ctx context.Context, userID, id, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.find(userID, id, version)
+	if err != nil {
+		return err
+	}
+	s.items = append(s.items[:i], s.items[i+1:]...)
+	return nil
+}
+
+// Snapshot saves the store's contents and returns a function that puts them
+// back, for rolling back a batch
+func (s *MemoryStore[T, P]) Snapshot() (restore func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items, nextID := slices.Clone(s.items), s.nextID
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.items, s.nextID = items, nextID
+	}
+}
+
+// find is index with the version check of Update and Delete
+func (s *MemoryStore[T, P]) find(userID, id, version int) (int, error) {
+	i := s.index(userID, id)
+	if i < 0 {
+		return -1, db.ErrNotFound
+	}
+	if version != 0 && P(&s.items[i]).owned().Version != version {
+		return -1, db.ErrConflict
+	}
+	return i, nil
+}
+
+// index finds an item the user owns; the caller holds s.mu
+func (s *MemoryStore[T, P]) index(userID, id int) int {
+	for i := range s.items {
+		if o := P(&s.items[i]).owned(); o.ID == id && o.UserID == userID {
+			return i
+		}
+	}
+	return -1
+}
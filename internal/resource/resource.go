@@ -0,0 +1,63 @@
+// Package resource implements the endpoints every per-user resource shares:
+// create, list, get, update, patch and delete, each scoped to the signed-in
+// user. A resource is a struct embedding Owned plus a Columns description,
+// which backs both the SQL and the memory store.
+//
+//	type Note struct {
+//		resource.Owned
+//		Title string `json:"title" binding:"required"`
+//	}
+package resource
+
+import (
+	"context"
+
+	"github.com/z-sk1/signin-api/internal/listquery"
+)
+
+// Owned is embedded in every resource. The framework fills it in from the
+// token and the database, so clients can't claim another user's rows
+type Owned struct {
+	ID       int    `json:"id" openapi:"readonly"`
+	UserID   int    `json:"-"`
+	Username string `json:"username" openapi:"readonly"`
+	// Version counts the writes to the item and is served as its ETag
+	Version int `json:"version" openapi:"readonly"`
+}
+
+func (o *Owned) owned() *Owned { return o }
+
+// Model is satisfied by a pointer to any struct embedding Owned
+type Model[T any] interface {
+	*T
+	owned() *Owned
+}
+
+// Store persists one resource; every method is scoped to the owning user and
+// returns db.ErrNotFound when the row doesn't exist or belongs to someone else.
+// Update and Delete take the version the caller last saw, item.Version for
+// Update, and return db.ErrConflict if the row has moved on since; a zero
+// version skips the check
+type Store[T any] interface {
+	Create(ctx context.Context, item *T) error
+	Get(ctx context.Context, userID, id int) (*T, error)
+	List(ctx context.Context, userID int, q listquery.Query) (listquery.Page[T], error)
+	Update(ctx context.Context, item *T) error
+	Delete(ctx context.Context, userID, id, version int) error
+}
+
+// Columns maps a resource onto its table. The id, user_id, username and
+// version columns come from Owned and aren't listed
+type Columns[T any] struct {
+	Table string
+	// Writable are the columns clients set, in the order Values returns them
+	Writable []string
+	Values   func(item *T) []any
+	// Read are all the columns read back, in the order Dest points into the
+	// item. It includes Writable plus any the database fills in
+	Read []string
+	Dest func(item *T) []any
+	// Field returns the value of a list field, for sorting and filtering in
+	// memory
+	Field listquery.Accessor[T]
+}
@@ -0,0 +1,86 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/z-sk1/signin-api/internal/db"
+)
+
+func TestMergePatch(t *testing.T) {
+	target := map[string]any{"title": "a", "content": "b", "tags": map[string]any{"x": 1.0, "y": 2.0}}
+	var patch map[string]any
+	if err := json.Unmarshal([]byte(`{"title": "c", "content": null, "tags": {"y": null, "z": 3}}`), &patch); err != nil {
+		t.Fatal(err)
+	}
+
+	got := mergePatch(target, patch)
+	want := map[string]any{"title": "c", "tags": map[string]any{"x": 1.0, "z": 3.0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("mergePatch = %v, want %v", got, want)
+	}
+}
+
+type item struct {
+	Owned
+	Title   string
+	Created time.Time
+}
+
+var itemColumns = Columns[item]{
+	Table:    "items",
+	Writable: []string{"title"},
+	Values:   func(i *item) []any { return []any{i.Title} },
+	Read:     []string{"title", "created"},
+	Dest:     func(i *item) []any { return []any{&i.Title, &i.Created} },
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore[item](itemColumns)
+
+	created := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	it := item{Owned: Owned{UserID: 1}, Title: "a", Created: created}
+	if err := s.Create(ctx, &it); err != nil || it.ID != 1 {
+		t.Fatalf("Create: id %d, %v", it.ID, err)
+	}
+
+	// only writable columns change
+	if err := s.Update(ctx, &item{Owned: Owned{ID: 1, UserID: 1}, Title: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get(ctx, 1, 1)
+	if err != nil || got.Title != "b" || got.Version != 2 || !got.Created.Equal(created) {
+		t.Fatalf("Get = %+v, %v", got, err)
+	}
+
+	// other users see nothing
+	if _, err := s.Get(ctx, 2, 1); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("Get as another user: %v", err)
+	}
+	if err := s.Update(ctx, &item{Owned: Owned{ID: 1, UserID: 2}}); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("Update as another user: %v", err)
+	}
+	if err := s.Delete(ctx, 2, 1, 0); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("Delete as another user: %v", err)
+	}
+
+	// writes against an old version conflict
+	if err := s.Update(ctx, &item{Owned: Owned{ID: 1, UserID: 1, Version: 1}, Title: "c"}); !errors.Is(err, db.ErrConflict) {
+		t.Fatalf("Update at version 1: %v", err)
+	}
+	if err := s.Delete(ctx, 1, 1, 1); !errors.Is(err, db.ErrConflict) {
+		t.Fatalf("Delete at version 1: %v", err)
+	}
+
+	if err := s.Delete(ctx, 1, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.Count(ctx, 1); n != 0 {
+		t.Fatalf("Count = %d after delete", n)
+	}
+}
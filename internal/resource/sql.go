@@ -0,0 +1,183 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/z-sk1/signin-api/internal/db"
+	"github.com/z-sk1/signin-api/internal/listquery"
+)
+
+// SQLStore is a Store over one table. Calls made inside db.Conn.InTx join
+// its transaction
+type SQLStore[T any, P Model[T]] struct {
+	conn *db.Conn
+	cols Columns[T]
+	// selected is the column list of every SELECT and RETURNING
+	selected string
+}
+
+func NewSQLStore[T any, P Model[T]](conn *db.Conn, cols Columns[T]) *SQLStore[T, P] {
+	return &SQLStore[T, P]{
+		conn:     conn,
+		cols:     cols,
+		selected: strings.Join(append([]string{"id", "user_id", "username", "version"}, cols.Read...), ", "),
+	}
+}
+
+// dest points into every selected column of item
+func (s *SQLStore[T, P]) dest(item *T) []any {
+	o := P(item).owned()
+	return append([]any{&o.ID, &o.UserID, &o.Username, &o.Version}, s.cols.Dest(item)...)
+}
+
+func (s *SQLStore[T, P]) Create(ctx context.Context, item *T) error {
+	ctx, cancel := s.conn.WithTimeout(ctx)
+	defer cancel()
+
+	o := P(item).owned()
+	columns := append([]string{"user_id", "username"}, s.cols.Writable...)
+	args := append([]any{o.UserID, o.Username}, s.cols.Values(item)...)
+
+	return s.conn.Using(ctx).QueryRowContext(ctx,
+		fmt.Sprintf("INSERT INTO %s(%s) VALUES (%s) RETURNING %s", s.cols.Table, strings.Join(columns, ", "), placeholders(1, len(args)), s.selected),
+		args...,
+	).Scan(s.dest(item)...)
+}
+
+func (s *SQLStore[T, P]) Get(ctx context.Context, userID, id int) (*T, error) {
+	ctx, cancel := s.conn.WithTimeout(ctx)
+	defer cancel()
+
+	item := new(T)
+	err := s.conn.Using(ctx).QueryRowContext(ctx,
+		fmt.Sprintf("SELECT %s FROM %s WHERE id = $1 AND user_id = $2", s.selected, s.cols.Table),
+		id, userID,
+	).Scan(s.dest(item)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, db.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *SQLStore[T, P]) List(ctx context.Context, userID int, q listquery.Query) (listquery.Page[T], error) {
+	ctx, cancel := s.conn.WithTimeout(ctx)
+	defer cancel()
+
+	conds, args := q.Where([]string{"user_id = $1"}, []any{userID})
+	var total int
+	if err := s.conn.Using(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM "+s.cols.Table+" WHERE "+strings.Join(conds, " AND "), args...).Scan(&total); err != nil {
+		return listquery.Page[T]{}, err
+	}
+
+	conds, args = q.Seek([]string{"user_id = $1"}, []any{userID})
+	rows, err := s.conn.Using(ctx).QueryContext(ctx,
+		fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s%s", s.selected, s.cols.Table, strings.Join(conds, " AND "), q.OrderBy(), q.LimitClause()),
+		args...,
+	)
+	if err != nil {
+		return listquery.Page[T]{}, err
+	}
+	defer rows.Close()
+
+	var items []T
+	for rows.Next() {
+		var item T
+		if err := rows.Scan(s.dest(&item)...); err != nil {
+			return listquery.Page[T]{}, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return listquery.Page[T]{}, err
+	}
+
+	return listquery.Finish(q, items, total, s.cols.Field), nil
+}
+
+// Count is the number of items userID owns
+func (s *SQLStore[T, P]) Count(ctx context.Context, userID int) (int, error) {
+	ctx, cancel := s.conn.WithTimeout(ctx)
+	defer cancel()
+
+	var total int
+	err := s.conn.Using(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM "+s.cols.Table+" WHERE user_id = $1", userID).Scan(&total)
+	return total, err
+}
+
+func (s *SQLStore[T, P]) Update(ctx context.Context, item *T) error {
+	ctx, cancel := s.conn.WithTimeout(ctx)
+	defer cancel()
+
+	sets := make([]string, len(s.cols.Writable))
+	for i, col := range s.cols.Writable {
+		sets[i] = fmt.Sprintf("%s = $%d", col, i+1)
+	}
+
+	// scoping by user_id makes sure the row belongs to the user
+	o := P(item).owned()
+	args := append(s.cols.Values(item), o.ID, o.UserID)
+	query := fmt.Sprintf("UPDATE %s SET %s, version = version + 1 WHERE id = $%d AND user_id = $%d", s.cols.Table, strings.Join(sets, ", "), len(args)-1, len(args))
+	if o.Version != 0 {
+		args = append(args, o.Version)
+		query += fmt.Sprintf(" AND version = $%d", len(args))
+	}
+
+	res, err := s.conn.Using(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	return s.changed(ctx, res, o.UserID, o.ID, o.Version)
+}
+
+func (s *SQLStore[T, P]) Delete(ctx context.Context, userID, id, version int) error {
+	ctx, cancel := s.conn.WithTimeout(ctx)
+	defer cancel()
+
+	query, args := "DELETE FROM "+s.cols.Table+" WHERE id = $1 AND user_id = $2", []any{id, userID}
+	if version != 0 {
+		query, args = query+" AND version = $3", append(args, version)
+	}
+
+	res, err := s.conn.Using(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	return s.changed(ctx, res, userID, id, version)
+}
+
+// changed tells a write that matched nothing because of its version check
+// apart from one whose row doesn't exist
+func (s *SQLStore[T, P]) changed(ctx context.Context, res sql.Result, userID, id, version int) error {
+	err := db.RequireRows(res)
+	if !errors.Is(err, db.ErrNotFound) || version == 0 {
+		return err
+	}
+
+	var exists bool
+	err = s.conn.Using(ctx).QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM "+s.cols.Table+" WHERE id = $1 AND user_id = $2)", id, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return db.ErrConflict
+	}
+	return db.ErrNotFound
+}
+
+// placeholders returns "$from, ..., $to"
+func placeholders(from, to int) string {
+	ps := make([]string, 0, to-from+1)
+	for i := from; i <= to; i++ {
+		ps = append(ps, fmt.Sprintf("$%d", i))
+	}
+	return strings.Join(ps, ", ")
+}
@@ -0,0 +1,173 @@
+package search
+
+import (
+	"cmp"
+	"context"
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/z-sk1/signin-api/internal/keep-track/expenses"
+	"github.com/z-sk1/signin-api/internal/listquery"
+	"github.com/z-sk1/signin-api/internal/remind-me/notes"
+	"github.com/z-sk1/signin-api/internal/remind-me/reminders"
+)
+
+// snippetLength is about how many bytes of text a scanned hit's snippet shows
+const snippetLength = 160
+
+// doc is an item as the scan sees it
+type doc struct {
+	id    int
+	title string
+	body  string
+}
+
+type scanRepository struct {
+	docs map[string]func(ctx context.Context, userID int) ([]doc, error)
+}
+
+// NewScanRepository searches by reading every item the user has of each type.
+// A hit has every word of the query somewhere in its title or body, ignoring
+// case; titles count double in the rank
+func NewScanRepository(n notes.Repository, r reminders.Repository, e expenses.Repository) Repository {
+	return &scanRepository{docs: map[string]func(ctx context.Context, userID int) ([]doc, error){
+		"notes": func(ctx context.Context, userID int) ([]doc, error) {
+			page, err := n.List(ctx, userID, listquery.Query{})
+			return docs(page.Items, func(n notes.Note) doc { return doc{n.ID, n.Title, n.Content} }), err
+		},
+		"reminders": func(ctx context.Context, userID int) ([]doc, error) {
+			page, err := r.List(ctx, userID, listquery.Query{})
+			return docs(page.Items, func(r reminders.Reminder) doc { return doc{r.ID, r.Title, r.Content} }), err
+		},
+		"expenses": func(ctx context.Context, userID int) ([]doc, error) {
+			page, err := e.List(ctx, userID, listquery.Query{})
+			return docs(page.Items, func(e expenses.Expense) doc { return doc{e.ID, e.Category, e.Note} }), err
+		},
+	}}
+}
+
+func docs[T any](items []T, f func(T) doc) []doc {
+	out := make([]doc, len(items))
+	for i, item := range items {
+		out[i] = f(item)
+	}
+	return out
+}
+
+func (r *scanRepository) Search(ctx context.Context, userID int, q Query) ([]Hit, int, error) {
+	terms := strings.Fields(strings.ToLower(strings.ReplaceAll(q.Text, `"`, " ")))
+	if len(terms) == 0 {
+		return nil, 0, nil
+	}
+	marks := marker(terms)
+
+	var hits []Hit
+	for _, t := range Types {
+		if !q.searches(t) {
+			continue
+		}
+		items, err := r.docs[t](ctx, userID)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, d := range items {
+			if rank, ok := score(d, terms); ok {
+				text := d.title
+				if marks.MatchString(d.body) {
+					text = d.body
+				}
+				hits = append(hits, Hit{Type: t, ID: d.id, Title: d.title, Snippet: snippet(text, marks), Rank: rank})
+			}
+		}
+	}
+
+	slices.SortStableFunc(hits, func(a, b Hit) int {
+		return cmp.Or(cmp.Compare(b.Rank, a.Rank), strings.Compare(a.Type, b.Type), cmp.Compare(a.ID, b.ID))
+	})
+
+	total := len(hits)
+	start := min(q.Offset, total)
+	end := min(start+q.Limit, total)
+	return hits[start:end], total, nil
+}
+
+// score ranks d between 0 and 1 when it has every term
+func score(d doc, terms []string) (float64, bool) {
+	title, body := strings.ToLower(d.title), strings.ToLower(d.body)
+
+	points := 0
+	for _, term := range terms {
+		inTitle, inBody := strings.Contains(title, term), strings.Contains(body, term)
+		if !inTitle && !inBody {
+			return 0, false
+		}
+		if inTitle {
+			points += 2
+		}
+		if inBody {
+			points++
+		}
+	}
+	return float64(points) / float64(3*len(terms)), true
+}
+
+// marker matches any of the terms, ignoring case. Longer terms come first so
+// "milk" isn't marked as just "mil"
+func marker(terms []string) *regexp.Regexp {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	slices.SortFunc(quoted, func(a, b string) int { return cmp.Compare(len(b), len(a)) })
+	return regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+}
+
+// snippet cuts about snippetLength bytes of text around its first match,
+// at spaces where it can, and marks every match in it
+func snippet(text string, marks *regexp.Regexp) string {
+	start, end := 0, len(text)
+	if len(text) > snippetLength {
+		if loc := marks.FindStringIndex(text); loc != nil && loc[0] > snippetLength/4 {
+			start = loc[0] - snippetLength/4
+			if i := strings.IndexByte(text[start:loc[0]], ' '); i >= 0 {
+				start += i + 1
+			}
+		}
+		end = min(len(text), start+snippetLength)
+		if i := strings.LastIndexByte(text[start:end], ' '); end < len(text) && i > 0 {
+			end = start + i
+		}
+		for start < end && !utf8.RuneStart(text[start]) {
+			start++
+		}
+		for end < len(text) && !utf8.RuneStart(text[end]) {
+			end--
+		}
+	}
+
+	out := mark(text[start:end], marks.FindAllStringIndex(text[start:end], -1))
+	if start > 0 {
+		out = "… " + out
+	}
+	if end < len(text) {
+		out += " …"
+	}
+	return out
+}
+
+// mark escapes text as HTML and wraps each match in <mark></mark>
+func mark(text string, matches [][]int) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(html.EscapeString(text[last:m[0]]))
+		b.WriteString("<mark>" + html.EscapeString(text[m[0]:m[1]]) + "</mark>")
+		last = m[1]
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String()
+}
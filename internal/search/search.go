@@ -0,0 +1,149 @@
+// Package search finds a user's notes, reminders and expenses by text. On
+// postgres it ranks with full-text search; other databases fall back to
+// scanning the user's items for every word of the query.
+package search
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/z-sk1/signin-api/internal/apierror"
+	"github.com/z-sk1/signin-api/internal/listquery"
+)
+
+// Types are the resources searched, by the plural they're served under
+var Types = []string{"notes", "reminders", "expenses"}
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+	maxText      = 200
+)
+
+type Query struct {
+	Text string
+	// Types limits the search to some of Types; every type when empty
+	Types  []string
+	Limit  int
+	Offset int
+}
+
+// Hit is one matching item. Title is an expense's category
+type Hit struct {
+	Type  string `json:"type"`
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	// Snippet is the best matching text as HTML: the user's text is escaped
+	// and each match is wrapped in <mark></mark>
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+// Repository searches the items of one user
+type Repository interface {
+	// Search returns a page of hits, best first, and how many there are in all
+	Search(ctx context.Context, userID int, q Query) ([]Hit, int, error)
+}
+
+// searches reports whether q includes type t
+func (q Query) searches(t string) bool {
+	return len(q.Types) == 0 || slices.Contains(q.Types, t)
+}
+
+type Handler struct {
+	Repo Repository
+}
+
+func NewHandler(repo Repository) *Handler {
+	return &Handler{Repo: repo}
+}
+
+// Search serves GET /search?q=...&type=notes,expenses&limit=&cursor=, paged
+// like the list routes
+func (h *Handler) Search(c *gin.Context) {
+	q, apiErr := parse(c.Request.URL.Query())
+	if apiErr != nil {
+		apierror.Abort(c, apiErr)
+		return
+	}
+
+	hits, total, err := h.Repo.Search(c.Request.Context(), c.GetInt("user_id"), q)
+	if err != nil {
+		apierror.Abort(c, apierror.Internal("search failed", err))
+		return
+	}
+	if hits == nil {
+		hits = []Hit{}
+	}
+
+	page := listquery.Page[Hit]{Items: hits, Total: total}
+	if next := q.Offset + len(hits); next < total {
+		page.Next = encodeCursor(cursor{Text: q.Text, Offset: next})
+	}
+	listquery.Write(c, "results", page)
+}
+
+func parse(values url.Values) (Query, *apierror.Error) {
+	q := Query{Text: strings.TrimSpace(values.Get("q")), Limit: DefaultLimit}
+	if q.Text == "" {
+		return Query{}, apierror.InvalidField("q", "required", "is required")
+	}
+	if len(q.Text) > maxText {
+		return Query{}, apierror.InvalidField("q", "max", fmt.Sprintf("must be at most %d characters", maxText))
+	}
+
+	for _, v := range values["type"] {
+		for _, t := range strings.Split(v, ",") {
+			if !slices.Contains(Types, t) {
+				return Query{}, apierror.InvalidField("type", "oneof", "must be one of "+strings.Join(Types, ", "))
+			}
+			q.Types = append(q.Types, t)
+		}
+	}
+
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxLimit {
+			return Query{}, apierror.InvalidField("limit", "out_of_range", fmt.Sprintf("must be between 1 and %d", MaxLimit))
+		}
+		q.Limit = n
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		cur, err := decodeCursor(v)
+		if err != nil || cur.Text != q.Text || cur.Offset < 0 {
+			return Query{}, apierror.InvalidField("cursor", "invalid", "is not a cursor for this search")
+		}
+		q.Offset = cur.Offset
+	}
+
+	return q, nil
+}
+
+// cursor is the position of the next page; it holds the text so it can't be
+// used to page through a different search
+type cursor struct {
+	Text   string `json:"q"`
+	Offset int    `json:"o"`
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	return c, json.Unmarshal(data, &c)
+}
@@ -0,0 +1,65 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSnippet(t *testing.T) {
+	marks := marker([]string{"milk"})
+
+	got := snippet(`<script>alert("milk")</script> & Milk`, marks)
+	want := `&lt;script&gt;alert(&#34;<mark>milk</mark>&#34;)&lt;/script&gt; &amp; <mark>Milk</mark>`
+	if got != want {
+		t.Fatalf("snippet = %q, want %q", got, want)
+	}
+
+	// long text is cut around the first match
+	long := strings.Repeat("filler ", 40) + "milk <b>" + strings.Repeat(" filler", 40)
+	got = snippet(long, marks)
+	if !strings.HasPrefix(got, "… ") || !strings.HasSuffix(got, " …") || !strings.Contains(got, "<mark>milk</mark> &lt;b&gt;") {
+		t.Fatalf("long snippet = %q", got)
+	}
+}
+
+func TestMarkup(t *testing.T) {
+	for headline, want := range map[string]string{
+		"buy \x02milk\x03 & <eggs>":         "buy <mark>milk</mark> &amp; &lt;eggs&gt;",
+		"\x02<i>\x03 … \x02milk\x03":        "<mark>&lt;i&gt;</mark> … <mark>milk</mark>",
+		"no match":                          "no match",
+		"unclosed \x02<img src=x onerror=>": "unclosed &lt;img src=x onerror=&gt;",
+	} {
+		if got := markup(headline); got != want {
+			t.Errorf("markup(%q) = %q, want %q", headline, got, want)
+		}
+	}
+}
+
+func TestSearchQuery(t *testing.T) {
+	hits := hitsQuery(Query{Types: []string{"expenses", "notes"}})
+	if strings.Count(hits, "SELECT") != 2 || !strings.Contains(hits, "'notes' AS type") ||
+		!strings.Contains(hits, "'expenses' AS type") || strings.Contains(hits, "reminders") {
+		t.Fatalf("hits query searches the wrong types: %s", hits)
+	}
+	if !strings.Contains(hits, "coalesce(category, '') AS title") || !strings.Contains(hits, "translate(coalesce(note, ''), "+selChars+", '') AS body") {
+		t.Fatalf("hits query reads the wrong columns: %s", hits)
+	}
+
+	// every type by default, and each placeholder used by the queries gets an
+	// argument from Search
+	all := hitsQuery(Query{})
+	if strings.Count(all, " UNION ALL ") != len(Types)-1 {
+		t.Fatalf("hits query for every type: %s", all)
+	}
+	for _, p := range []string{"$1", "$2", "$3", "$4", "$5"} {
+		if !strings.Contains(searchQuery(all), p) {
+			t.Fatalf("search query doesn't use %s", p)
+		}
+	}
+	if strings.Contains(searchQuery(all), "$6") || strings.Contains(countQuery(all), "$3") {
+		t.Fatal("queries use more arguments than they're given")
+	}
+	if strings.Contains(searchQuery(all), "<mark>") {
+		t.Fatal("ts_headline must not write markup")
+	}
+}
@@ -0,0 +1,149 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/z-sk1/signin-api/internal/db"
+)
+
+// source is a searched table and the columns its hits are built from
+type source struct {
+	table string
+	title string
+	body  string
+}
+
+var sources = map[string]source{
+	"notes":     {table: "notes", title: "title", body: "content"},
+	"reminders": {table: "reminders", title: "title", body: "content"},
+	"expenses":  {table: "expenses", title: "category", body: "note"},
+}
+
+// ts_headline brackets each match with control characters rather than markup,
+// so the text can be escaped before they're turned into <mark>. They're taken
+// out of the text first, as selChars in SQL
+const (
+	startSel = "\x02"
+	stopSel  = "\x03"
+	selChars = `E'\x02\x03'`
+	headline = `StartSel="` + startSel + `", StopSel="` + stopSel + `", MinWords=10, MaxWords=30, MaxFragments=2, FragmentDelimiter=" … "`
+)
+
+type sqlRepository struct {
+	conn *db.Conn
+}
+
+// NewSQLRepository searches the postgres full-text columns added with the
+// search migration. Other dialects need NewScanRepository
+func NewSQLRepository(conn *db.Conn) Repository {
+	return &sqlRepository{conn: conn}
+}
+
+func (r *sqlRepository) Search(ctx context.Context, userID int, q Query) ([]Hit, int, error) {
+	ctx, cancel := r.conn.WithTimeout(ctx)
+	defer cancel()
+
+	selects := hitsQuery(q)
+	rows, err := r.conn.QueryContext(ctx, searchQuery(selects), userID, q.Text, q.Limit, q.Offset, headline)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var hits []Hit
+	total := 0
+	for rows.Next() {
+		var h Hit
+		if err := rows.Scan(&h.Type, &h.ID, &h.Title, &h.Snippet, &h.Rank, &total); err != nil {
+			return nil, 0, err
+		}
+		h.Snippet = markup(h.Snippet)
+		hits = append(hits, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// a page past the end has no rows to carry the total
+	if len(hits) == 0 && q.Offset > 0 {
+		return r.count(ctx, userID, q, selects)
+	}
+	return hits, total, nil
+}
+
+func (r *sqlRepository) count(ctx context.Context, userID int, q Query, selects string) ([]Hit, int, error) {
+	var total int
+	err := r.conn.QueryRowContext(ctx, countQuery(selects), userID, q.Text).Scan(&total)
+	return nil, total, err
+}
+
+// hitsQuery selects the matching items of every type q searches, taking the
+// user's id as $1 and the query from the q CTE. The selection characters are
+// taken out of the text so only ts_headline's brackets a match
+func hitsQuery(q Query) string {
+	var selects []string
+	for _, t := range Types {
+		if !q.searches(t) {
+			continue
+		}
+		s := sources[t]
+		selects = append(selects, fmt.Sprintf(
+			`SELECT '%s' AS type, id, coalesce(%s, '') AS title, translate(coalesce(%s, ''), %s, '') AS body, ts_rank(search, q.query) AS rank FROM %s, q WHERE user_id = $1 AND search @@ q.query`,
+			t, s.title, s.body, selChars, s.table,
+		))
+	}
+	return strings.Join(selects, " UNION ALL ")
+}
+
+// searchQuery pages through hits, taking the text as $2, the limit and offset
+// as $3 and $4 and the headline options as $5. The snippet comes from the body
+// when it matches and the title otherwise; the total rides along on every row
+func searchQuery(hits string) string {
+	return fmt.Sprintf(`
+		WITH q AS (SELECT websearch_to_tsquery('english', $2) AS query),
+		hits AS (%s)
+		SELECT type, id, title,
+			CASE WHEN to_tsvector('english', body) @@ q.query
+				THEN ts_headline('english', body, q.query, $5)
+				ELSE ts_headline('english', translate(title, %s, ''), q.query, $5)
+			END,
+			rank, COUNT(*) OVER ()
+		FROM hits, q
+		ORDER BY rank DESC, type, id
+		LIMIT $3 OFFSET $4`,
+		hits, selChars)
+}
+
+func countQuery(hits string) string {
+	return fmt.Sprintf(`
+		WITH q AS (SELECT websearch_to_tsquery('english', $2) AS query)
+		SELECT COUNT(*) FROM (%s) hits`,
+		hits)
+}
+
+// markup escapes a headline as HTML and turns its brackets into <mark></mark>
+func markup(headline string) string {
+	var b strings.Builder
+	for {
+		before, rest, ok := strings.Cut(headline, startSel)
+		if !ok {
+			break
+		}
+		match, after, ok := strings.Cut(rest, stopSel)
+		if !ok {
+			break
+		}
+		b.WriteString(escape(before))
+		b.WriteString("<mark>" + escape(match) + "</mark>")
+		headline = after
+	}
+	b.WriteString(escape(headline))
+	return b.String()
+}
+
+func escape(s string) string {
+	return html.EscapeString(strings.NewReplacer(startSel, "", stopSel, "").Replace(s))
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/z-sk1/signin-api/internal/auth"
+	leaderboard "github.com/z-sk1/signin-api/internal/bateenfest"
+	"github.com/z-sk1/signin-api/internal/config"
+	"github.com/z-sk1/signin-api/internal/health"
+	"github.com/z-sk1/signin-api/internal/idempotency"
+	"github.com/z-sk1/signin-api/internal/keep-track/expenses"
+	"github.com/z-sk1/signin-api/internal/listquery"
+	"github.com/z-sk1/signin-api/internal/openapi"
+	"github.com/z-sk1/signin-api/internal/remind-me/notes"
+	"github.com/z-sk1/signin-api/internal/remind-me/reminders"
+	"github.com/z-sk1/signin-api/internal/resource"
+	"github.com/z-sk1/signin-api/internal/search"
+)
+
+// response bodies the handlers build with gin.H, spelled out for the spec
+type (
+	message struct {
+		Message string `json:"message"`
+	}
+	status struct {
+		Status string `json:"status"`
+	}
+	readiness struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}
+	tokenResponse struct {
+		Token string `json:"token"`
+	}
+	resetLink struct {
+		Message    string `json:"message"`
+		ResetToken string `json:"reset_token"`
+	}
+	profile struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	}
+	count struct {
+		Total int `json:"total"`
+	}
+	noteList struct {
+		Notes      []notes.Note `json:"notes"`
+		NextCursor string       `json:"next_cursor,omitempty"`
+	}
+	reminderList struct {
+		Reminders  []reminders.Reminder `json:"reminders"`
+		NextCursor string               `json:"next_cursor,omitempty"`
+	}
+	expenseList struct {
+		Expenses   []expenses.Expense `json:"expenses"`
+		NextCursor string             `json:"next_cursor,omitempty"`
+	}
+	expenseTotal struct {
+		Total float64 `json:"total"`
+	}
+	categoryTotals struct {
+		Categories []expenses.CategoryTotal `json:"categories"`
+	}
+	leaderboardPage struct {
+		Entries    []leaderboard.LeaderboardEntry `json:"entries"`
+		NextCursor string                         `json:"next_cursor,omitempty"`
+	}
+	searchResults struct {
+		Results    []search.Hit `json:"results"`
+		NextCursor string       `json:"next_cursor,omitempty"`
+	}
+)
+
+// listParams documents the paging, sort and filter parameters of a list route
+func listParams(spec listquery.Spec) []openapi.Param {
+	var sorts []any
+	for _, f := range spec.Fields {
+		if f.Sort {
+			sorts = append(sorts, f.Name, "-"+f.Name)
+		}
+	}
+
+	params := []openapi.Param{
+		{Name: "limit", Description: "page size", Schema: openapi.Schema{"type": "integer", "minimum": 1, "maximum": listquery.MaxLimit, "default": listquery.DefaultLimit}},
+		{Name: "cursor", Description: "next_cursor from the previous page", Schema: openapi.Schema{"type": "string"}},
+		{Name: "sort", Description: "field to sort by, descending with a leading -", Schema: openapi.Schema{"type": "string", "enum": append([]any{"id", "-id"}, sorts...)}},
+	}
+
+	for _, f := range spec.Fields {
+		if !f.Filter {
+			continue
+		}
+
+		schema := openapi.Schema{"type": "string"}
+		switch f.Kind {
+		case listquery.Int:
+			schema = openapi.Schema{"type": "integer"}
+		case listquery.Float:
+			schema = openapi.Schema{"type": "number"}
+		case listquery.Time:
+			schema = openapi.Schema{"type": "string", "format": "date-time"}
+		}
+
+		params = append(params, openapi.Param{Name: f.Name, Description: "equal to", Schema: schema})
+		if f.Kind == listquery.String {
+			continue
+		}
+		for _, op := range []listquery.Op{listquery.Gt, listquery.Gte, listquery.Lt, listquery.Lte} {
+			params = append(params, openapi.Param{Name: f.Name + "[" + string(op) + "]", Description: string(op), Schema: schema})
+		}
+	}
+
+	return params
+}
+
+var searchParams = []openapi.Param{
+	{Name: "q", Description: "words to find; postgres also takes \"phrases\", or and -word", Required: true, Schema: openapi.Schema{"type": "string"}},
+	{Name: "type", Description: "comma-separated types to search, all by default", Schema: openapi.Schema{"type": "string", "example": strings.Join(search.Types, ",")}},
+	{Name: "limit", Description: "page size", Schema: openapi.Schema{"type": "integer", "minimum": 1, "maximum": search.MaxLimit, "default": search.DefaultLimit}},
+	{Name: "cursor", Description: "next_cursor from the previous page", Schema: openapi.Schema{"type": "string"}},
+}
+
+// headers of the routes that serve ETags and take conditional writes
+var (
+	etagHeader     = openapi.Param{Name: "ETag", Description: "identifies this representation; an item's also names its version", Schema: openapi.Schema{"type": "string"}}
+	ifNoneMatch    = openapi.Param{Name: "If-None-Match", Description: "an ETag from an earlier response; answered with 304 while it still matches", Schema: openapi.Schema{"type": "string"}}
+	ifMatch        = openapi.Param{Name: "If-Match", Description: "the ETag of the version being changed; required when the server is set to require it", Schema: openapi.Schema{"type": "string"}}
+	idempotencyKey = openapi.Param{Name: idempotency.Header, Description: "makes retries of this request run it only once, when the server keeps idempotency keys", Schema: openapi.Schema{"type": "string", "maxLength": 255}}
+	location       = openapi.Param{Name: "Location", Description: "where the new item can be fetched", Schema: openapi.Schema{"type": "string"}}
+)
+
+// cached documents a GET served with an ETag, which If-None-Match turns into
+// a 304
+func cached(op openapi.Operation) openapi.Operation {
+	op.Headers = append(op.Headers, ifNoneMatch)
+	op.ResponseHeaders = append(op.ResponseHeaders, etagHeader)
+	op.Statuses = append(op.Statuses, http.StatusNotModified)
+	return op
+}
+
+// created documents a create answered with the new item, its ETag and Location
+func created(op openapi.Operation) openapi.Operation {
+	op.Status = http.StatusCreated
+	op.ResponseHeaders = append(op.ResponseHeaders, etagHeader, location)
+	return op
+}
+
+// conditional documents a write that If-Match makes against one version
+func conditional(op openapi.Operation) openapi.Operation {
+	op.Headers = append(op.Headers, ifMatch)
+	op.Statuses = append(op.Statuses, http.StatusPreconditionFailed, http.StatusPreconditionRequired)
+	// a delete leaves no version to tag
+	if op.Response != (message{}) {
+		op.ResponseHeaders = append(op.ResponseHeaders, etagHeader)
+	}
+	return op
+}
+
+// operations documents every route for /openapi.json, by its path without the
+// version prefix. TestOpenAPI fails when a registered route is missing here
+var operations = map[string]openapi.Operation{
+	"GET /healthz":      {Summary: "liveness probe", Tag: "probes", Response: status{}},
+	"GET /readyz":       {Summary: "readiness probe with per-dependency checks", Tag: "probes", Response: readiness{}},
+	"GET /version":      {Summary: "build information", Tag: "probes", Response: health.BuildInfo{}},
+	"GET /metrics":      {Summary: "Prometheus metrics", Tag: "probes", Response: "", ContentType: "text/plain"},
+	"GET /openapi.json": {Summary: "this document", Tag: "docs", Response: map[string]any{}},
+	"GET /docs":         {Summary: "interactive API docs", Tag: "docs", Response: "", ContentType: "text/html"},
+
+	"POST /signup":          {Summary: "create an account", Tag: "auth", Request: auth.SignUpRequest{}, Response: message{}},
+	"POST /login":           {Summary: "exchange a username or email and password for a token", Tag: "auth", Request: auth.User{}, Response: tokenResponse{}},
+	"POST /forgot-password": {Summary: "start a password reset", Tag: "auth", Request: auth.ForgotPasswordRequest{}, Response: resetLink{}},
+	"POST /reset-password":  {Summary: "set a new password with a reset token", Tag: "auth", Request: auth.ResetPasswordRequest{}, Response: message{}},
+	"POST /setup":           {Summary: "create the first admin with the setup token", Tag: "auth", Request: auth.SetupRequest{}, Response: message{}},
+	"GET /me":               {Summary: "the signed-in user", Tag: "auth", Auth: true, Response: profile{}},
+	"DELETE /delete":        {Summary: "delete the signed-in account", Tag: "auth", Auth: true, Response: message{}},
+
+	"GET /leaderboard/:section":     cached(openapi.Operation{Summary: "scores in a section, highest first", Tag: "leaderboard", Response: leaderboardPage{}, Query: listParams(leaderboard.ListSpec)}),
+	"POST /admin/leaderboard":       {Summary: "add a score", Tag: "leaderboard", Auth: true, Request: leaderboard.LeaderboardEntry{}, Response: message{}, Status: http.StatusCreated},
+	"PUT /admin/leaderboard/:id":    {Summary: "update a score", Tag: "leaderboard", Auth: true, Request: leaderboard.LeaderboardEntry{}, Response: message{}},
+	"DELETE /admin/leaderboard/:id": {Summary: "delete a score", Tag: "leaderboard", Auth: true, Response: message{}},
+	"GET /admin/config":             {Summary: "effective configuration with secrets redacted", Tag: "admin", Auth: true, Response: config.Config{}},
+
+	"POST /notes":           created(openapi.Operation{Summary: "create a note", Tag: "notes", Auth: true, Request: notes.Note{}, Response: notes.Note{}}),
+	"GET /notes":            cached(openapi.Operation{Summary: "list notes", Tag: "notes", Auth: true, Response: noteList{}, Query: listParams(notes.ListSpec)}),
+	"GET /notes/total":      {Summary: "count notes", Tag: "notes", Auth: true, Response: count{}},
+	"GET /notes/:id":        cached(openapi.Operation{Summary: "get a note", Tag: "notes", Auth: true, Response: notes.Note{}}),
+	"PUT /notes/:id":        conditional(openapi.Operation{Summary: "update a note", Tag: "notes", Auth: true, Request: notes.Note{}, Response: notes.Note{}}),
+	"PATCH /notes/:id":      conditional(openapi.Operation{Summary: "change some fields of a note with a JSON Merge Patch", Tag: "notes", Auth: true, Request: map[string]any{}, RequestType: "application/merge-patch+json", Response: notes.Note{}}),
+	"DELETE /notes/:id":     conditional(openapi.Operation{Summary: "delete a note", Tag: "notes", Auth: true, Response: message{}}),
+	"POST /reminders":       created(openapi.Operation{Summary: "create a reminder", Tag: "reminders", Auth: true, Request: reminders.Reminder{}, Response: reminders.Reminder{}}),
+	"GET /reminders":        cached(openapi.Operation{Summary: "list reminders", Tag: "reminders", Auth: true, Response: reminderList{}, Query: listParams(reminders.ListSpec)}),
+	"GET /reminders/total":  {Summary: "count reminders", Tag: "reminders", Auth: true, Response: count{}},
+	"GET /reminders/:id":    cached(openapi.Operation{Summary: "get a reminder", Tag: "reminders", Auth: true, Response: reminders.Reminder{}}),
+	"PUT /reminders/:id":    conditional(openapi.Operation{Summary: "update a reminder", Tag: "reminders", Auth: true, Request: reminders.Reminder{}, Response: reminders.Reminder{}}),
+	"PATCH /reminders/:id":  conditional(openapi.Operation{Summary: "change some fields of a reminder with a JSON Merge Patch", Tag: "reminders", Auth: true, Request: map[string]any{}, RequestType: "application/merge-patch+json", Response: reminders.Reminder{}}),
+	"DELETE /reminders/:id": conditional(openapi.Operation{Summary: "delete a reminder", Tag: "reminders", Auth: true, Response: message{}}),
+
+	"POST /expenses":           created(openapi.Operation{Summary: "record an expense", Tag: "expenses", Auth: true, Request: expenses.Expense{}, Response: expenses.Expense{}}),
+	"GET /expenses":            cached(openapi.Operation{Summary: "list expenses", Tag: "expenses", Auth: true, Response: expenseList{}, Query: listParams(expenses.ListSpec)}),
+	"GET /expenses/total":      {Summary: "sum of all expenses", Tag: "expenses", Auth: true, Response: expenseTotal{}},
+	"GET /expenses/categories": {Summary: "totals per category", Tag: "expenses", Auth: true, Response: categoryTotals{}},
+	"GET /expenses/:id":        cached(openapi.Operation{Summary: "get an expense", Tag: "expenses", Auth: true, Response: expenses.Expense{}}),
+	"PUT /expenses/:id":        conditional(openapi.Operation{Summary: "update an expense", Tag: "expenses", Auth: true, Request: expenses.Expense{}, Response: expenses.Expense{}}),
+	"PATCH /expenses/:id":      conditional(openapi.Operation{Summary: "change some fields of an expense with a JSON Merge Patch", Tag: "expenses", Auth: true, Request: map[string]any{}, RequestType: "application/merge-patch+json", Response: expenses.Expense{}}),
+	"DELETE /expenses/:id":     conditional(openapi.Operation{Summary: "delete an expense", Tag: "expenses", Auth: true, Response: message{}}),
+
+	"POST /batch": {Summary: "create, update and delete many notes, reminders and expenses in one transaction", Tag: "batch", Auth: true, Request: resource.BatchRequest{}, Response: resource.BatchResponse{}},
+	"GET /search": cached(openapi.Operation{Summary: "find notes, reminders and expenses by text, best matches first", Tag: "search", Auth: true, Response: searchResults{}, Query: searchParams}),
+}
+
+// describe looks routes up in operations, marking the unversioned aliases of
+// versioned routes as deprecated and signed-in POSTs as taking an
+// Idempotency-Key
+func describe(routes gin.RoutesInfo) func(method, path string) (openapi.Operation, bool) {
+	versioned := map[string]bool{}
+	for _, route := range routes {
+		if path := unversioned(route.Path); path != route.Path {
+			versioned[openapi.Key(route.Method, path)] = true
+		}
+	}
+
+	return func(method, path string) (openapi.Operation, bool) {
+		key := openapi.Key(method, unversioned(path))
+		op, ok := operations[key]
+		if ok && path == unversioned(path) && versioned[key] {
+			op.Deprecated = true
+		}
+		if ok && method == http.MethodPost && op.Auth {
+			// clipped so the table's own slice is never appended to
+			op.Headers = append(slices.Clip(op.Headers), idempotencyKey)
+		}
+		return op, ok
+	}
+}
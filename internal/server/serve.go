@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+type ServeOptions struct {
+	Addr string
+
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownTimeout bounds how long in-flight requests get to finish
+	ShutdownTimeout time.Duration
+	// DrainDelay keeps serving after shutdown starts so load balancers see
+	// readiness fail before connections are refused
+	DrainDelay time.Duration
+	// OnShutdown is called as soon as shutdown starts
+	OnShutdown func()
+
+	// TLS is enabled when both files are set
+	TLSCertFile string
+	TLSKeyFile  string
+	// HTTP3 additionally serves QUIC on the same port over UDP; requires TLS
+	HTTP3 bool
+}
+
+func (o ServeOptions) tls() bool {
+	return o.TLSCertFile != "" && o.TLSKeyFile != ""
+}
+
+// Serve runs handler until ctx is cancelled, then stops accepting connections
+// and waits up to ShutdownTimeout for in-flight requests to complete
+func Serve(ctx context.Context, handler http.Handler, opts ServeOptions) error {
+	if opts.HTTP3 && !opts.tls() {
+		return errors.New("HTTP/3 requires a TLS certificate and key")
+	}
+
+	var h3 *http3.Server
+	if opts.HTTP3 {
+		h3 = &http3.Server{
+			Addr:        opts.Addr,
+			Handler:     handler,
+			IdleTimeout: opts.IdleTimeout,
+		}
+
+		// advertise HTTP/3 to clients that connect over TCP first
+		tcpHandler := handler
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h3.SetQUICHeaders(w.Header())
+			tcpHandler.ServeHTTP(w, r)
+		})
+	}
+
+	srv := &http.Server{
+		Addr:              opts.Addr,
+		Handler:           handler,
+		ReadTimeout:       opts.ReadTimeout,
+		ReadHeaderTimeout: opts.ReadHeaderTimeout,
+		WriteTimeout:      opts.WriteTimeout,
+		IdleTimeout:       opts.IdleTimeout,
+	}
+
+	errs := make(chan error, 2)
+
+	go func() {
+		var err error
+		if opts.tls() {
+			slog.Info("listening", "addr", opts.Addr, "protocol", "https")
+			err = srv.ListenAndServeTLS(opts.TLSCertFile, opts.TLSKeyFile)
+		} else {
+			slog.Info("listening", "addr", opts.Addr, "protocol", "http")
+			err = srv.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			errs <- err
+		}
+	}()
+
+	if h3 != nil {
+		go func() {
+			slog.Info("listening", "addr", opts.Addr, "protocol", "http/3")
+			err := h3.ListenAndServeTLS(opts.TLSCertFile, opts.TLSKeyFile)
+			if !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("http/3: %w", err)
+			}
+		}()
+	}
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down, draining in-flight requests")
+
+	if opts.OnShutdown != nil {
+		opts.OnShutdown()
+	}
+	time.Sleep(opts.DrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), opts.ShutdownTimeout)
+	defer cancel()
+
+	var h3Err error
+	if h3 != nil {
+		h3Err = h3.Shutdown(shutdownCtx)
+	}
+	srvErr := srv.Shutdown(shutdownCtx)
+
+	return errors.Join(h3Err, srvErr)
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	return ln.Addr().String()
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	addr := freeAddr(t)
+	started := make(chan struct{})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	var drained atomic.Bool
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- Serve(ctx, handler, ServeOptions{
+			Addr:            addr,
+			ShutdownTimeout: 5 * time.Second,
+			OnShutdown:      func() { drained.Store(true) },
+		})
+	}()
+
+	// wait for the listener
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if i == 50 {
+			t.Fatal("server never started listening")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	respErr := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("status %s", resp.Status)
+			}
+		}
+		respErr <- err
+	}()
+
+	<-started
+	cancel()
+
+	if err := <-respErr; err != nil {
+		t.Fatalf("in-flight request failed during shutdown: %v", err)
+	}
+	if err := <-serveErr; err != nil {
+		t.Fatalf("Serve returned %v", err)
+	}
+	if !drained.Load() {
+		t.Fatal("OnShutdown was not called")
+	}
+}
+
+func TestServeHTTP3RequiresTLS(t *testing.T) {
+	err := Serve(context.Background(), http.NotFoundHandler(), ServeOptions{Addr: freeAddr(t), HTTP3: true})
+	if err == nil {
+		t.Fatal("expected an error when HTTP/3 is enabled without TLS")
+	}
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/z-sk1/signin-api/internal/apierror"
+	"github.com/z-sk1/signin-api/internal/auth"
+	leaderboard "github.com/z-sk1/signin-api/internal/bateenfest"
+	"github.com/z-sk1/signin-api/internal/config"
+	"github.com/z-sk1/signin-api/internal/db"
+	"github.com/z-sk1/signin-api/internal/health"
+	"github.com/z-sk1/signin-api/internal/idempotency"
+	"github.com/z-sk1/signin-api/internal/keep-track/expenses"
+	"github.com/z-sk1/signin-api/internal/listquery"
+	"github.com/z-sk1/signin-api/internal/logging"
+	"github.com/z-sk1/signin-api/internal/metrics"
+	"github.com/z-sk1/signin-api/internal/openapi"
+	"github.com/z-sk1/signin-api/internal/remind-me/notes"
+	"github.com/z-sk1/signin-api/internal/remind-me/reminders"
+	"github.com/z-sk1/signin-api/internal/resource"
+	"github.com/z-sk1/signin-api/internal/search"
+	"github.com/z-sk1/signin-api/internal/validation"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// Stores holds one repository per domain
+type Stores struct {
+	Users       auth.Repository
+	Notes       notes.Repository
+	Reminders   reminders.Repository
+	Expenses    expenses.Repository
+	Leaderboard leaderboard.Repository
+	Idempotency idempotency.Repository
+	// Atomic groups store writes into one transaction, as POST /batch does.
+	// The memory stores only roll back notes, reminders and expenses
+	Atomic resource.Atomic
+	Search search.Repository
+}
+
+// SQLStores backs every domain with the given database, whatever its dialect
+func SQLStores(conn *db.Conn) Stores {
+	n, r, e := notes.NewSQLRepository(conn), reminders.NewSQLRepository(conn), expenses.NewSQLRepository(conn)
+
+	// only postgres has the full-text columns
+	finder := search.NewScanRepository(n, r, e)
+	if conn.Dialect == db.Postgres {
+		finder = search.NewSQLRepository(conn)
+	}
+
+	return Stores{
+		Users:       auth.NewSQLRepository(conn),
+		Notes:       n,
+		Reminders:   r,
+		Expenses:    e,
+		Leaderboard: leaderboard.NewSQLRepository(conn),
+		Idempotency: idempotency.NewSQLRepository(conn),
+		Atomic:      conn.InTx,
+		Search:      finder,
+	}
+}
+
+func MemoryStores() Stores {
+	n, r, e := notes.NewMemoryRepository(), reminders.NewMemoryRepository(), expenses.NewMemoryRepository()
+
+	return Stores{
+		Users:       auth.NewMemoryRepository(),
+		Notes:       n,
+		Reminders:   r,
+		Expenses:    e,
+		Leaderboard: leaderboard.NewMemoryRepository(),
+		Idempotency: idempotency.NewMemoryRepository(),
+		Atomic:      resource.MemoryAtomic(n.(resource.Snapshotter), r.(resource.Snapshotter), e.(resource.Snapshotter)),
+		Search:      search.NewScanRepository(n, r, e),
+	}
+}
+
+type Options struct {
+	Stores Stores
+	JWTKey []byte
+	// Config is the effective configuration; defaults are used when nil
+	Config *config.Config
+	// Health backs /readyz; an empty checker is used when nil
+	Health *health.Checker
+	// SetupToken enables POST /setup for creating the first admin
+	SetupToken string
+}
+
+// the root aliases of /v1 were deprecated with its release and go away after
+var (
+	legacySince  = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	legacySunset = time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC)
+)
+
+// New builds the router with every route wired to handlers backed by the stores
+func New(opts Options) *gin.Engine {
+	stores := opts.Stores
+
+	cfg := opts.Config
+	if cfg == nil {
+		cfg = config.Default()
+	}
+
+	checker := opts.Health
+	if checker == nil {
+		checker = health.NewChecker()
+	}
+
+	authHandler := auth.NewHandler(stores.Users, opts.JWTKey, cfg.Auth.TokenTTL.Duration, cfg.Auth.ResetTokenTTL.Duration)
+	setupHandler := auth.NewSetupHandler(stores.Users, opts.SetupToken)
+	notesHandler := notes.NewHandler(stores.Notes)
+	remindersHandler := reminders.NewHandler(stores.Reminders)
+	expensesHandler := expenses.NewHandler(stores.Expenses)
+	notesHandler.RequireIfMatch = cfg.Server.RequireIfMatch
+	remindersHandler.RequireIfMatch = cfg.Server.RequireIfMatch
+	expensesHandler.RequireIfMatch = cfg.Server.RequireIfMatch
+	leaderboardHandler := leaderboard.NewHandler(stores.Leaderboard)
+	searchHandler := search.NewHandler(stores.Search)
+	batchHandler := &resource.Batch{
+		Resources: map[string]resource.Batchable{
+			"notes":     notesHandler,
+			"reminders": remindersHandler,
+			"expenses":  expensesHandler,
+		},
+		Atomic:        stores.Atomic,
+		MaxOperations: cfg.Server.MaxBatchOperations,
+	}
+
+	validation.Register()
+
+	r := gin.New()
+	r.Use(
+		otelgin.Middleware(cfg.Tracing.ServiceName),
+		logging.RequestIDMiddleware,
+		logging.AccessLog,
+		metrics.Middleware,
+		apierror.Middleware,
+		limitBody(int64(cfg.Server.MaxBodyBytes)),
+	)
+
+	// unknown routes get the same problem+json body as every other error
+	r.NoRoute(func(c *gin.Context) {
+		apierror.Abort(c, apierror.NotFound("route not found"))
+	})
+
+	r.Use(cors.New(cors.Config{
+		AllowOrigins:     []string{"*"}, // or ["http://localhost:5173"] if you want to be strict
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type", logging.RequestIDHeader, "traceparent", "tracestate", "If-Match", "If-None-Match", idempotency.Header},
+		ExposeHeaders:    []string{"Content-Length", logging.RequestIDHeader, "Deprecation", "Sunset", "Link", "ETag", "Location", listquery.TotalCountHeader, idempotency.ReplayedHeader},
+		AllowCredentials: true,
+		MaxAge:           12 * time.Hour,
+	}))
+
+	// probes
+	r.GET("/healthz", checker.Liveness)
+	r.GET("/readyz", checker.Readiness)
+	r.GET("/version", health.VersionHandler)
+	r.GET("/metrics", metrics.Handler())
+
+	// docs
+	r.GET("/openapi.json", openapi.SpecHandler(func() *openapi.Document {
+		info := openapi.Info{Title: "signin-api", Version: health.Version}
+		return openapi.Build(info, r.Routes(), describe(r.Routes()), apierror.Problem{}, apierror.ContentType)
+	}))
+	r.GET("/docs", openapi.DocsHandler("/openapi.json"))
+
+	// the API itself, one entry per resource. Signed-in POSTs can carry an
+	// Idempotency-Key so clients may retry creates
+	signedIn := []gin.HandlerFunc{authHandler.RequireAuth}
+	if window := cfg.Server.IdempotencyWindow.Duration; window > 0 {
+		signedIn = append(signedIn, idempotency.Middleware(stores.Idempotency, window, unversioned))
+	}
+	protected := func(g *gin.RouterGroup) *gin.RouterGroup {
+		return g.Group("", signedIn...)
+	}
+
+	v1 := APIVersion{Name: "v1", Resources: map[string]Routes{
+		"auth": func(g *gin.RouterGroup) {
+			g.POST("/signup", authHandler.SignUp)
+			g.POST("/login", authHandler.Login)
+			g.POST("/forgot-password", authHandler.ForgotPassword)
+			g.POST("/reset-password", authHandler.ResetPassword)
+			g.POST("/setup", setupHandler.Setup)
+
+			authed := protected(g)
+			authed.GET("/me", authHandler.Me)
+			authed.DELETE("/delete", authHandler.DeleteAccount)
+		},
+		"leaderboard": func(g *gin.RouterGroup) {
+			g.GET("/leaderboard/:section", leaderboardHandler.GetAllLeaderboardScores)
+
+			admin := protected(g).Group("/admin", authHandler.RequireAdmin)
+			admin.POST("/leaderboard", leaderboardHandler.AddLeaderboardScore)
+			admin.DELETE("/leaderboard/:id", leaderboardHandler.DeleteLeaderboardScore)
+			admin.PUT("/leaderboard/:id", leaderboardHandler.UpdateLeaderboardScore)
+		},
+		"config": func(g *gin.RouterGroup) {
+			admin := protected(g).Group("/admin", authHandler.RequireAdmin)
+			admin.GET("/config", func(c *gin.Context) {
+				c.JSON(http.StatusOK, cfg.Redacted())
+			})
+		},
+		"notes": func(g *gin.RouterGroup) {
+			authed := protected(g)
+			notesHandler.Routes(authed)
+			authed.GET("/notes/total", notesHandler.GetNoteCount)
+		},
+		"reminders": func(g *gin.RouterGroup) {
+			authed := protected(g)
+			remindersHandler.Routes(authed)
+			authed.GET("/reminders/total", remindersHandler.GetReminderCount)
+		},
+		"expenses": func(g *gin.RouterGroup) {
+			authed := protected(g)
+			expensesHandler.Routes(authed)
+			authed.GET("/expenses/total", expensesHandler.GetTotalExpenses)
+			authed.GET("/expenses/categories", expensesHandler.GetExpenseCategories)
+		},
+		"batch": func(g *gin.RouterGroup) {
+			protected(g).POST("/batch", batchHandler.Handle)
+		},
+		"search": func(g *gin.RouterGroup) {
+			protected(g).GET("/search", searchHandler.Search)
+		},
+	}}
+
+	// later versions go here, e.g. v1.Next("v2", map[string]Routes{"notes": ...})
+	for _, version := range []APIVersion{v1} {
+		version.mount(r.Group("/" + version.Name))
+	}
+
+	// the unversioned paths clients used before /v1, kept until the sunset
+	v1.mount(r.Group("/", Deprecated(Deprecation{
+		Since:     legacySince,
+		Sunset:    legacySunset,
+		Successor: func(path string) string { return "/v1" + path },
+	})))
+
+	return r
+}
+
+// limitBody rejects requests whose body is larger than n bytes, up front when
+// the length is declared and otherwise once decoding reads past the limit
+func limitBody(n int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > n {
+			apierror.Abort(c, apierror.New(http.StatusRequestEntityTooLarge, apierror.CodeRequestTooLarge, fmt.Sprintf("request body exceeds %d bytes", n)))
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, n)
+		c.Next()
+	}
+}
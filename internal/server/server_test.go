@@ -0,0 +1,1339 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/z-sk1/signin-api/internal/apierror"
+	"github.com/z-sk1/signin-api/internal/auth"
+	"github.com/z-sk1/signin-api/internal/config"
+	"github.com/z-sk1/signin-api/internal/db"
+	"github.com/z-sk1/signin-api/internal/idempotency"
+	"github.com/z-sk1/signin-api/internal/listquery"
+	"github.com/z-sk1/signin-api/internal/resource"
+	"github.com/z-sk1/signin-api/internal/search"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+type testAPI struct {
+	t      *testing.T
+	router *gin.Engine
+	stores Stores
+}
+
+func newTestAPI(t *testing.T, stores Stores) *testAPI {
+	return &testAPI{t: t, router: New(Options{Stores: stores, JWTKey: []byte("test-secret")}), stores: stores}
+}
+
+// forEachBackend runs test once against the in-memory stores and once against
+// a freshly migrated sqlite database
+func forEachBackend(t *testing.T, test func(t *testing.T, api *testAPI)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, newTestAPI(t, MemoryStores()))
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		conn, err := db.Connect(db.SQLite, filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		if err := conn.MigrateUp(); err != nil {
+			t.Fatal(err)
+		}
+
+		test(t, newTestAPI(t, SQLStores(conn)))
+	})
+}
+
+// do sends a JSON request and decodes the JSON response into out when given
+func (a *testAPI) do(method, path, token string, body any, out any) int {
+	a.t.Helper()
+
+	w := a.send(method, path, token, nil, body)
+
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			a.t.Fatalf("%s %s: decode %q: %v", method, path, w.Body.String(), err)
+		}
+	}
+
+	return w.Code
+}
+
+// send is do with extra request headers, returning the whole response
+func (a *testAPI) send(method, path, token string, header http.Header, body any) *httptest.ResponseRecorder {
+	a.t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, req)
+	return w
+}
+
+func (a *testAPI) expect(want int, method, path, token string, body any, out any) {
+	a.t.Helper()
+
+	if got := a.do(method, path, token, body, out); got != want {
+		a.t.Fatalf("%s %s: status %d, want %d", method, path, got, want)
+	}
+}
+
+func (a *testAPI) login(identifier, password string) string {
+	a.t.Helper()
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	a.expect(http.StatusOK, "POST", "/v1/login", "", gin.H{"username": identifier, "password": password}, &resp)
+	return resp.Token
+}
+
+// signUp creates a regular user and returns a token for it
+func (a *testAPI) signUp(username string) string {
+	a.t.Helper()
+
+	a.expect(http.StatusOK, "POST", "/v1/signup", "", gin.H{"username": username, "email": username + "@example.com", "password": "hunter22"}, nil)
+	return a.login(username, "hunter22")
+}
+
+func (a *testAPI) admin() string {
+	a.t.Helper()
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte("adminpass"), bcrypt.MinCost)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	err = a.stores.Users.CreateUser(context.Background(), &auth.User{Email: "admin@example.com", Username: "admin", Password: string(hashed), Role: "admin"})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.login("admin", "adminpass")
+}
+
+func TestProtectedRoutesRequireToken(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, api *testAPI) {
+
+		public := map[string]bool{
+			"POST /signup":              true,
+			"POST /login":               true,
+			"POST /forgot-password":     true,
+			"POST /reset-password":      true,
+			"POST /setup":               true,
+			"GET /leaderboard/:section": true,
+			"GET /healthz":              true,
+			"GET /readyz":               true,
+			"GET /version":              true,
+			"GET /metrics":              true,
+			"GET /openapi.json":         true,
+			"GET /docs":                 true,
+		}
+
+		for _, route := range api.router.Routes() {
+			if public[route.Method+" "+unversioned(route.Path)] {
+				continue
+			}
+
+			path := route.Path
+			for _, param := range []string{":id", ":section"} {
+				path = strings.ReplaceAll(path, param, "1")
+			}
+
+			api.expect(http.StatusUnauthorized, route.Method, path, "", nil, nil)
+			api.expect(http.StatusUnauthorized, route.Method, path, "not-a-jwt", nil, nil)
+		}
+	})
+}
+
+func TestOpenAPI(t *testing.T) {
+	api := newTestAPI(t, MemoryStores())
+
+	var spec struct {
+		OpenAPI    string                                         `json:"openapi"`
+		Paths      map[string]map[string]struct{ Summary string } `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Required   []string                  `json:"required"`
+				Properties map[string]map[string]any `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	api.expect(http.StatusOK, "GET", "/openapi.json", "", nil, &spec)
+
+	if spec.OpenAPI != "3.1.0" {
+		t.Fatalf("openapi = %q, want 3.1.0", spec.OpenAPI)
+	}
+
+	// every registered route has to be documented in operations
+	for _, route := range api.router.Routes() {
+		path := route.Path
+		for _, param := range []string{"id", "section"} {
+			path = strings.ReplaceAll(path, ":"+param, "{"+param+"}")
+		}
+
+		op, ok := spec.Paths[path][strings.ToLower(route.Method)]
+		if !ok || op.Summary == "" {
+			t.Errorf("%s %s is missing from the spec", route.Method, route.Path)
+		}
+	}
+
+	// schemas carry the binding rules
+	note := spec.Components.Schemas["Note"]
+	if len(note.Required) != 1 || note.Required[0] != "title" || note.Properties["title"]["maxLength"] != float64(200) {
+		t.Fatalf("unexpected Note schema %+v", note)
+	}
+	if spec.Components.Schemas["Expense"].Properties["date"]["format"] != "date-time" {
+		t.Fatalf("expense date should be a date-time")
+	}
+	if note.Properties["id"]["readOnly"] != true || note.Properties["version"]["readOnly"] != true || note.Properties["title"]["readOnly"] != nil {
+		t.Fatalf("the server-set Note fields should be read only: %+v", note.Properties)
+	}
+
+	// the headers and statuses of conditional requests and creates
+	var ops map[string]map[string]struct {
+		Parameters []struct {
+			Name     string `json:"name"`
+			In       string `json:"in"`
+			Required bool   `json:"required"`
+		} `json:"parameters"`
+		Responses map[string]struct {
+			Headers map[string]any `json:"headers"`
+		} `json:"responses"`
+	}
+	var raw struct {
+		Paths json.RawMessage `json:"paths"`
+	}
+	api.expect(http.StatusOK, "GET", "/openapi.json", "", nil, &raw)
+	if err := json.Unmarshal(raw.Paths, &ops); err != nil {
+		t.Fatal(err)
+	}
+	params := func(path, method string) map[string]bool {
+		required := map[string]bool{}
+		for _, p := range ops[path][method].Parameters {
+			required[p.In+" "+p.Name] = p.Required
+		}
+		return required
+	}
+
+	create := ops["/v1/notes"]["post"].Responses["201"]
+	if _, ok := params("/v1/notes", "post")["header Idempotency-Key"]; !ok || create.Headers["Location"] == nil || create.Headers["ETag"] == nil {
+		t.Errorf("POST /v1/notes: params %v, 201 headers %v", params("/v1/notes", "post"), create.Headers)
+	}
+	if _, ok := params("/v1/signup", "post")["header Idempotency-Key"]; ok {
+		t.Error("signup isn't covered by idempotency keys")
+	}
+	update := ops["/v1/notes/{id}"]["put"]
+	if _, ok := params("/v1/notes/{id}", "put")["header If-Match"]; !ok || update.Responses["412"].Headers != nil || len(update.Responses) != 4 {
+		t.Errorf("PUT /v1/notes/{id}: params %v, responses %v", params("/v1/notes/{id}", "put"), update.Responses)
+	}
+	if _, ok := ops["/v1/notes/{id}"]["get"].Responses["304"]; !ok || !params("/v1/notes/{id}", "get")["path id"] {
+		t.Errorf("GET /v1/notes/{id}: params %v, responses %v", params("/v1/notes/{id}", "get"), ops["/v1/notes/{id}"]["get"].Responses)
+	}
+	if !params("/v1/search", "get")["query q"] {
+		t.Error("search q should be required")
+	}
+
+	req := httptest.NewRequest("GET", "/docs", nil)
+	w := httptest.NewRecorder()
+	api.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/openapi.json") {
+		t.Fatalf("GET /docs: status %d", w.Code)
+	}
+}
+
+func TestVersioning(t *testing.T) {
+	api := newTestAPI(t, MemoryStores())
+	token := api.signUp("sam")
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		api.router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("/v1/notes"); w.Code != http.StatusOK || w.Header().Get("Deprecation") != "" {
+		t.Fatalf("/v1/notes: status %d, deprecation %q", w.Code, w.Header().Get("Deprecation"))
+	}
+
+	// the old root paths still work but say where to go instead
+	w := get("/notes")
+	if w.Code != http.StatusOK {
+		t.Fatalf("/notes: status %d", w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("Deprecation"), "@") || w.Header().Get("Sunset") == "" {
+		t.Fatalf("missing deprecation headers: %v", w.Header())
+	}
+	if link := w.Header().Get("Link"); link != `</v1/notes>; rel="successor-version"` {
+		t.Fatalf("Link = %q", link)
+	}
+
+	// a later version can replace or drop resources and keep the rest
+	handler := func(body string) Routes {
+		return func(g *gin.RouterGroup) {
+			g.GET("/"+body, func(c *gin.Context) { c.String(http.StatusOK, body) })
+		}
+	}
+	v1 := APIVersion{Name: "v1", Resources: map[string]Routes{"a": handler("a"), "b": handler("b"), "c": handler("c")}}
+	v2 := v1.Next("v2", map[string]Routes{"b": nil, "c": func(g *gin.RouterGroup) {
+		g.GET("/c", func(c *gin.Context) { c.String(http.StatusOK, "c2") })
+	}})
+
+	r := gin.New()
+	r.Use(apierror.Middleware)
+	v1.mount(r.Group("/v1"))
+	v2.mount(r.Group("/v2"))
+	retired := APIVersion{Name: "v0", Resources: v1.Resources, Deprecation: &Deprecation{Since: time.Unix(0, 0), Sunset: time.Now().Add(-time.Hour)}}
+	retired.mount(r.Group("/v0"))
+
+	for path, want := range map[string]string{"/v1/b": "b", "/v1/c": "c", "/v2/a": "a", "/v2/c": "c2"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Body.String() != want {
+			t.Errorf("%s = %q, want %q", path, w.Body.String(), want)
+		}
+	}
+	for path, want := range map[string]int{"/v2/b": http.StatusNotFound, "/v0/a": http.StatusGone} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != want {
+			t.Errorf("%s: status %d, want %d", path, w.Code, want)
+		}
+	}
+}
+
+func TestProblemResponses(t *testing.T) {
+	api := newTestAPI(t, MemoryStores())
+	token := api.signUp("sam")
+
+	req := httptest.NewRequest("GET", "/v1/me", nil)
+	req.Header.Set("X-Request-ID", "trace-me")
+	w := httptest.NewRecorder()
+	api.router.ServeHTTP(w, req)
+
+	var body struct {
+		Type      string `json:"type"`
+		Status    int    `json:"status"`
+		Code      string `json:"code"`
+		Instance  string `json:"instance"`
+		RequestID string `json:"request_id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/problem+json") {
+		t.Fatalf("content type %q, want application/problem+json", ct)
+	}
+	if body.Status != http.StatusUnauthorized || body.Code != "unauthorized" || body.Type != "urn:signin-api:problem:unauthorized" || body.Instance != "/v1/me" {
+		t.Fatalf("unexpected problem %s", w.Body.String())
+	}
+	if w.Header().Get("X-Request-ID") != "trace-me" || body.RequestID != "trace-me" {
+		t.Fatalf("request id not propagated: header %q, body %s", w.Header().Get("X-Request-ID"), w.Body.String())
+	}
+
+	// validation failures name the offending fields
+	var invalid struct {
+		Code   string `json:"code"`
+		Errors []struct {
+			Field string `json:"field"`
+			Code  string `json:"code"`
+		} `json:"errors"`
+	}
+	api.expect(http.StatusBadRequest, "POST", "/v1/reminders", token, gin.H{"title": "t", "due": "tomorrow"}, &invalid)
+	if invalid.Code != "validation_failed" || len(invalid.Errors) != 1 || invalid.Errors[0].Field != "due" {
+		t.Fatalf("unexpected validation problem %+v", invalid)
+	}
+
+	api.expect(http.StatusBadRequest, "POST", "/v1/notes", token, gin.H{"title": 5}, &invalid)
+	if len(invalid.Errors) != 1 || invalid.Errors[0].Field != "title" || invalid.Errors[0].Code != "invalid_type" {
+		t.Fatalf("unexpected bind problem %+v", invalid)
+	}
+
+	var missing struct {
+		Code string `json:"code"`
+	}
+	api.expect(http.StatusNotFound, "GET", "/no-such-route", "", nil, &missing)
+	if missing.Code != "not_found" {
+		t.Fatalf("unknown route code %q, want not_found", missing.Code)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.MaxBodyBytes = 1024
+	stores := MemoryStores()
+	api := &testAPI{t: t, router: New(Options{Stores: stores, JWTKey: []byte("test-secret"), Config: cfg}), stores: stores}
+	token := api.signUp("sam")
+
+	var problem struct {
+		Code   string `json:"code"`
+		Errors []struct {
+			Field string `json:"field"`
+			Code  string `json:"code"`
+		} `json:"errors"`
+	}
+
+	api.expect(http.StatusBadRequest, "POST", "/v1/expenses", token, gin.H{"amount": -5, "category": "", "date": "2030-01-02T12:00:00Z", "currency": "usd"}, &problem)
+	got := map[string]string{}
+	for _, fe := range problem.Errors {
+		got[fe.Field] = fe.Code
+	}
+	if got["amount"] != "gt" || got["category"] != "required" || got["currency"] != "currency" || len(got) != 3 {
+		t.Fatalf("unexpected field errors %+v", problem.Errors)
+	}
+
+	api.expect(http.StatusCreated, "POST", "/v1/expenses", token, gin.H{"amount": 5, "category": "food", "date": "2030-01-02T12:00:00Z", "currency": "EUR"}, nil)
+
+	api.expect(http.StatusBadRequest, "POST", "/v1/notes", token, gin.H{"title": strings.Repeat("x", 201)}, &problem)
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "title" || problem.Errors[0].Code != "max" {
+		t.Fatalf("unexpected field errors %+v", problem.Errors)
+	}
+
+	api.expect(http.StatusRequestEntityTooLarge, "POST", "/v1/notes", token, gin.H{"title": "t", "content": strings.Repeat("x", 2048)}, &problem)
+	if problem.Code != "request_too_large" {
+		t.Fatalf("code %q, want request_too_large", problem.Code)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	api := newTestAPI(t, MemoryStores())
+	token := api.signUp("sam")
+
+	api.expect(http.StatusUnauthorized, "POST", "/v1/login", "", gin.H{"username": "sam", "password": "wrong"}, nil)
+	api.expect(http.StatusNotFound, "DELETE", "/v1/notes/41", token, nil, nil)
+	api.expect(http.StatusNotFound, "DELETE", "/v1/notes/42", token, nil, nil)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	api.router.ServeHTTP(w, req)
+	body := w.Body.String()
+
+	for _, want := range []string{
+		`http_requests_total{method="DELETE",route="/v1/notes/:id",status="404"}`,
+		`http_request_duration_seconds_bucket{method="DELETE",route="/v1/notes/:id"`,
+		`auth_logins_total{result="success"}`,
+		`auth_logins_total{result="invalid"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+	if strings.Contains(body, "/v1/notes/41") {
+		t.Error("raw paths leaked into metric labels")
+	}
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	forEachBackend(t, func(t *testing.T, api *testAPI) {
+		api.signUp("sam")
+	})
+
+	// an incoming traceparent is continued rather than replaced
+	api := newTestAPI(t, MemoryStores())
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	api.router.ServeHTTP(httptest.NewRecorder(), req)
+
+	names := map[string]bool{}
+	continued := false
+	for _, span := range recorder.Ended() {
+		names[span.Name()] = true
+		if span.SpanContext().TraceID().String() == "4bf92f3577b34da6a3ce929d0e0e4736" {
+			continued = true
+		}
+	}
+
+	for _, want := range []string{"POST /v1/login", "bcrypt hash", "bcrypt compare", "db SELECT", "db INSERT"} {
+		if !names[want] {
+			t.Errorf("no %q span recorded, got %v", want, names)
+		}
+	}
+	if !continued {
+		t.Error("incoming trace context was not continued")
+	}
+}
+
+func TestAuthFlow(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, api *testAPI) {
+
+		token := api.signUp("sam")
+
+		// duplicate username or email is rejected
+		api.expect(http.StatusConflict, "POST", "/v1/signup", "", gin.H{"username": "sam", "email": "other@example.com", "password": "hunter22"}, nil)
+
+		// an account must have every field, a real-looking email and a long
+		// enough password
+		type problem struct {
+			Code   string `json:"code"`
+			Errors []struct {
+				Field string `json:"field"`
+				Code  string `json:"code"`
+			} `json:"errors"`
+		}
+		for _, tc := range []struct {
+			body  gin.H
+			field string
+			code  string
+		}{
+			{gin.H{"email": "kim@example.com", "password": "hunter22"}, "username", "required"},
+			{gin.H{"username": "kim", "email": "", "password": "hunter22"}, "email", "required"},
+			{gin.H{"username": "kim", "email": "kim@example.com"}, "password", "required"},
+			{gin.H{"username": "kim", "email": "not-an-email", "password": "hunter22"}, "email", "email"},
+			{gin.H{"username": "kim", "email": "kim@example.com", "password": "short"}, "password", "min"},
+		} {
+			var p problem
+			api.expect(http.StatusBadRequest, "POST", "/v1/signup", "", tc.body, &p)
+			if p.Code != "validation_failed" || len(p.Errors) != 1 || p.Errors[0].Field != tc.field || p.Errors[0].Code != tc.code {
+				t.Fatalf("signup %v: %+v, want %s %s", tc.body, p, tc.field, tc.code)
+			}
+		}
+		api.expect(http.StatusUnauthorized, "POST", "/v1/login", "", gin.H{"username": "kim", "password": "hunter22"}, nil)
+
+		// wrong password
+		api.expect(http.StatusUnauthorized, "POST", "/v1/login", "", gin.H{"username": "sam", "password": "wrong"}, nil)
+
+		// login by email
+		api.expect(http.StatusOK, "POST", "/v1/login", "", gin.H{"email": "sam@example.com", "password": "hunter22"}, nil)
+
+		var me struct {
+			Username string `json:"username"`
+			Email    string `json:"email"`
+		}
+		api.expect(http.StatusOK, "GET", "/v1/me", token, nil, &me)
+		if me.Username != "sam" || me.Email != "sam@example.com" {
+			t.Fatalf("unexpected /me response %+v", me)
+		}
+
+		// unknown emails get the same answer without a token
+		var forgot struct {
+			ResetToken string `json:"reset_token"`
+		}
+		api.expect(http.StatusOK, "POST", "/v1/forgot-password", "", gin.H{"email": "nobody@example.com"}, &forgot)
+		if forgot.ResetToken != "" {
+			t.Fatal("reset token issued for unknown email")
+		}
+
+		api.expect(http.StatusOK, "POST", "/v1/forgot-password", "", gin.H{"email": "sam@example.com"}, &forgot)
+		if forgot.ResetToken == "" {
+			t.Fatal("no reset token issued")
+		}
+
+		api.expect(http.StatusBadRequest, "POST", "/v1/reset-password", "", gin.H{"token": "bogus", "password": "newpass1"}, nil)
+
+		// a new password follows the signup rules, and a rejected one leaves
+		// the token unused
+		var rejected apierror.Problem
+		api.expect(http.StatusBadRequest, "POST", "/v1/reset-password", "", gin.H{"token": forgot.ResetToken, "password": "short"}, &rejected)
+		if rejected.Code != apierror.CodeValidationFailed || len(rejected.Errors) != 1 || rejected.Errors[0].Field != "password" || rejected.Errors[0].Code != "min" {
+			t.Fatalf("short reset password: %+v", rejected)
+		}
+		api.expect(http.StatusOK, "POST", "/v1/reset-password", "", gin.H{"token": forgot.ResetToken, "password": "newpass1"}, nil)
+
+		// the token is single use
+		api.expect(http.StatusBadRequest, "POST", "/v1/reset-password", "", gin.H{"token": forgot.ResetToken, "password": "another1"}, nil)
+
+		token = api.login("sam", "newpass1")
+
+		// owned rows are removed along with the account
+		api.expect(http.StatusCreated, "POST", "/v1/notes", token, gin.H{"title": "t"}, nil)
+		api.expect(http.StatusCreated, "POST", "/v1/expenses", token, gin.H{"amount": 1, "category": "c", "date": "2030-01-02T12:00:00Z"}, nil)
+
+		api.expect(http.StatusOK, "DELETE", "/v1/delete", token, nil, nil)
+		api.expect(http.StatusUnauthorized, "GET", "/v1/me", token, nil, nil)
+	})
+}
+
+func TestDisabledUser(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, api *testAPI) {
+		token := api.signUp("sam")
+
+		if err := api.stores.Users.SetDisabled(context.Background(), "sam", true); err != nil {
+			t.Fatal(err)
+		}
+
+		// existing tokens stop working and new logins are refused
+		api.expect(http.StatusForbidden, "GET", "/v1/me", token, nil, nil)
+		api.expect(http.StatusForbidden, "POST", "/v1/login", "", gin.H{"username": "sam", "password": "hunter22"}, nil)
+
+		// a wrong password still looks like any other failed login
+		api.expect(http.StatusUnauthorized, "POST", "/v1/login", "", gin.H{"username": "sam", "password": "wrong"}, nil)
+
+		if err := api.stores.Users.SetDisabled(context.Background(), "sam", false); err != nil {
+			t.Fatal(err)
+		}
+		api.expect(http.StatusOK, "GET", "/v1/me", token, nil, nil)
+	})
+}
+
+func TestSetup(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, api *testAPI) {
+
+		// setup is off unless a token was issued at startup
+		api.expect(http.StatusGone, "POST", "/v1/setup", "", gin.H{"token": "", "username": "root", "email": "root@example.com", "password": "rootpass"}, nil)
+
+		api.router = New(Options{Stores: api.stores, JWTKey: []byte("test-secret"), SetupToken: "setup-token"})
+
+		api.expect(http.StatusForbidden, "POST", "/v1/setup", "", gin.H{"token": "wrong", "username": "root", "email": "root@example.com", "password": "rootpass"}, nil)
+		var invalid struct {
+			Code string `json:"code"`
+		}
+		api.expect(http.StatusBadRequest, "POST", "/v1/setup", "", gin.H{"token": "setup-token", "username": "root"}, &invalid)
+		if invalid.Code != "validation_failed" {
+			t.Fatalf("setup without email and password: %+v", invalid)
+		}
+		api.expect(http.StatusBadRequest, "POST", "/v1/setup", "", gin.H{"token": "setup-token", "username": "root", "email": "root", "password": "rootpass"}, nil)
+		api.expect(http.StatusOK, "POST", "/v1/setup", "", gin.H{"token": "setup-token", "username": "root", "email": "root@example.com", "password": "rootpass"}, nil)
+
+		// the new account is an admin
+		token := api.login("root", "rootpass")
+		api.expect(http.StatusOK, "GET", "/v1/admin/config", token, nil, nil)
+
+		// and the token only works once
+		api.expect(http.StatusGone, "POST", "/v1/setup", "", gin.H{"token": "setup-token", "username": "root2", "email": "root2@example.com", "password": "rootpass"}, nil)
+	})
+}
+
+func TestNotes(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, api *testAPI) {
+		token := api.signUp("sam")
+		other := api.signUp("alex")
+
+		api.expect(http.StatusCreated, "POST", "/v1/notes", token, gin.H{"title": "groceries", "content": "milk"}, nil)
+		api.expect(http.StatusCreated, "POST", "/v1/notes", token, gin.H{"title": "todo", "content": "call mum"}, nil)
+
+		var list struct {
+			Notes []struct {
+				ID       int    `json:"id"`
+				Username string `json:"username"`
+				Title    string `json:"title"`
+				Content  string `json:"content"`
+			} `json:"notes"`
+		}
+		api.expect(http.StatusOK, "GET", "/v1/notes", token, nil, &list)
+		if len(list.Notes) != 2 || list.Notes[0].Title != "groceries" || list.Notes[0].Username != "sam" {
+			t.Fatalf("unexpected notes %+v", list.Notes)
+		}
+
+		var total struct {
+			Total int `json:"total"`
+		}
+		api.expect(http.StatusOK, "GET", "/v1/notes/total", token, nil, &total)
+		if total.Total != 2 {
+			t.Fatalf("total = %d, want 2", total.Total)
+		}
+
+		id := list.Notes[0].ID
+		path := "/v1/notes/" + strconv.Itoa(id)
+
+		api.expect(http.StatusOK, "PUT", path, token, gin.H{"title": "groceries", "content": "milk, eggs"}, nil)
+		api.expect(http.StatusNotFound, "PUT", path, other, gin.H{"title": "mine now"}, nil)
+		api.expect(http.StatusNotFound, "PUT", "/v1/notes/999", token, gin.H{"title": "x"}, nil)
+		api.expect(http.StatusBadRequest, "PUT", "/v1/notes/abc", token, gin.H{"title": "x"}, nil)
+
+		api.expect(http.StatusOK, "GET", "/v1/notes", token, nil, &list)
+		if list.Notes[0].Content != "milk, eggs" {
+			t.Fatalf("note not updated: %+v", list.Notes[0])
+		}
+
+		api.expect(http.StatusNotFound, "DELETE", path, other, nil, nil)
+		api.expect(http.StatusOK, "DELETE", path, token, nil, nil)
+		api.expect(http.StatusNotFound, "DELETE", path, token, nil, nil)
+		api.expect(http.StatusBadRequest, "DELETE", "/v1/notes/abc", token, nil, nil)
+
+		api.expect(http.StatusOK, "GET", "/v1/notes/total", token, nil, &total)
+		if total.Total != 1 {
+			t.Fatalf("total = %d, want 1", total.Total)
+		}
+	})
+}
+
+func TestReminders(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, api *testAPI) {
+		token := api.signUp("sam")
+
+		api.expect(http.StatusBadRequest, "POST", "/v1/reminders", token, gin.H{"title": "dentist", "due": "tomorrow"}, nil)
+		api.expect(http.StatusCreated, "POST", "/v1/reminders", token, gin.H{"title": "dentist", "content": "2pm", "due": "2030-01-02T14:00:00Z"}, nil)
+
+		var list struct {
+			Reminders []struct {
+				ID    int    `json:"id"`
+				Title string `json:"title"`
+				Due   string `json:"due"`
+			} `json:"reminders"`
+		}
+		api.expect(http.StatusOK, "GET", "/v1/reminders", token, nil, &list)
+		if len(list.Reminders) != 1 || list.Reminders[0].Title != "dentist" {
+			t.Fatalf("unexpected reminders %+v", list.Reminders)
+		}
+
+		var total struct {
+			Total int `json:"total"`
+		}
+		api.expect(http.StatusOK, "GET", "/v1/reminders/total", token, nil, &total)
+		if total.Total != 1 {
+			t.Fatalf("total = %d, want 1", total.Total)
+		}
+
+		path := "/v1/reminders/" + strconv.Itoa(list.Reminders[0].ID)
+
+		api.expect(http.StatusBadRequest, "PUT", path, token, gin.H{"title": "dentist"}, nil)
+		api.expect(http.StatusOK, "PUT", path, token, gin.H{"title": "dentist", "due": "2030-01-03T14:00:00Z"}, nil)
+		api.expect(http.StatusNotFound, "PUT", "/v1/reminders/999", token, gin.H{"title": "dentist", "due": "2030-01-03T14:00:00Z"}, nil)
+
+		api.expect(http.StatusOK, "GET", "/v1/reminders", token, nil, &list)
+		if list.Reminders[0].Due != "2030-01-03T14:00:00Z" {
+			t.Fatalf("reminder not updated: %+v", list.Reminders[0])
+		}
+
+		api.expect(http.StatusOK, "DELETE", path, token, nil, nil)
+		api.expect(http.StatusNotFound, "DELETE", path, token, nil, nil)
+	})
+}
+
+func TestExpenses(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, api *testAPI) {
+		token := api.signUp("sam")
+
+		api.expect(http.StatusBadRequest, "POST", "/v1/expenses", token, gin.H{"amount": 5, "category": "food", "date": "yesterday"}, nil)
+		api.expect(http.StatusCreated, "POST", "/v1/expenses", token, gin.H{"amount": 12.5, "category": "food", "date": "2030-01-02T12:00:00Z"}, nil)
+		api.expect(http.StatusCreated, "POST", "/v1/expenses", token, gin.H{"amount": 7.5, "category": "food", "date": "2030-01-03T12:00:00Z"}, nil)
+		api.expect(http.StatusCreated, "POST", "/v1/expenses", token, gin.H{"amount": 30, "category": "travel", "date": "2030-01-03T12:00:00Z", "note": "train"}, nil)
+
+		var list struct {
+			Expenses []struct {
+				ID       int     `json:"id"`
+				Amount   float64 `json:"amount"`
+				Category string  `json:"category"`
+			} `json:"expenses"`
+		}
+		api.expect(http.StatusOK, "GET", "/v1/expenses", token, nil, &list)
+		if len(list.Expenses) != 3 {
+			t.Fatalf("got %d expenses, want 3", len(list.Expenses))
+		}
+
+		var total struct {
+			Total float64 `json:"total"`
+		}
+		api.expect(http.StatusOK, "GET", "/v1/expenses/total", token, nil, &total)
+		if total.Total != 50 {
+			t.Fatalf("total = %v, want 50", total.Total)
+		}
+
+		var categories struct {
+			Categories []struct {
+				Category string  `json:"category"`
+				Total    float64 `json:"total"`
+			} `json:"categories"`
+		}
+		api.expect(http.StatusOK, "GET", "/v1/expenses/categories", token, nil, &categories)
+		totals := map[string]float64{}
+		for _, ct := range categories.Categories {
+			totals[ct.Category] = ct.Total
+		}
+		if totals["food"] != 20 || totals["travel"] != 30 {
+			t.Fatalf("unexpected category totals %v", totals)
+		}
+
+		path := "/v1/expenses/" + strconv.Itoa(list.Expenses[2].ID)
+
+		api.expect(http.StatusBadRequest, "PUT", path, token, gin.H{"amount": 10, "category": "travel", "date": "soon"}, nil)
+		api.expect(http.StatusOK, "PUT", path, token, gin.H{"amount": 10, "category": "travel", "date": "2030-01-03T12:00:00Z"}, nil)
+
+		api.expect(http.StatusOK, "GET", "/v1/expenses/total", token, nil, &total)
+		if total.Total != 30 {
+			t.Fatalf("total = %v, want 30", total.Total)
+		}
+
+		api.expect(http.StatusOK, "DELETE", path, token, nil, nil)
+		api.expect(http.StatusNotFound, "DELETE", path, token, nil, nil)
+	})
+}
+
+func TestGetAndPatch(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, api *testAPI) {
+		token := api.signUp("sam")
+		other := api.signUp("alex")
+
+		api.expect(http.StatusCreated, "POST", "/v1/reminders", token, gin.H{"title": "dentist", "content": "2pm", "due": "2030-01-02T14:00:00Z"}, nil)
+
+		type reminder struct {
+			ID        int    `json:"id"`
+			Username  string `json:"username"`
+			Title     string `json:"title"`
+			Content   string `json:"content"`
+			Due       string `json:"due"`
+			CreatedAt string `json:"created_at"`
+		}
+		var got reminder
+		api.expect(http.StatusOK, "GET", "/v1/reminders/1", token, nil, &got)
+		if got.Title != "dentist" || got.Username != "sam" || got.Due != "2030-01-02T14:00:00Z" {
+			t.Fatalf("GET reminder = %+v", got)
+		}
+		api.expect(http.StatusNotFound, "GET", "/v1/reminders/1", other, nil, nil)
+		api.expect(http.StatusNotFound, "GET", "/v1/reminders/999", token, nil, nil)
+		api.expect(http.StatusBadRequest, "GET", "/v1/reminders/abc", token, nil, nil)
+
+		// no due date needed to change the title
+		var patched reminder
+		api.expect(http.StatusOK, "PATCH", "/v1/reminders/1", token, gin.H{"title": "orthodontist"}, &patched)
+		if patched.Title != "orthodontist" || patched.Content != "2pm" || patched.Due != got.Due || patched.CreatedAt == "" {
+			t.Fatalf("PATCH title = %+v", patched)
+		}
+
+		// null clears a field, but not one that's required
+		api.expect(http.StatusOK, "PATCH", "/v1/reminders/1", token, gin.H{"content": nil}, &patched)
+		if patched.Content != "" || patched.Title != "orthodontist" {
+			t.Fatalf("PATCH null = %+v", patched)
+		}
+		api.expect(http.StatusBadRequest, "PATCH", "/v1/reminders/1", token, gin.H{"due": nil}, nil)
+		api.expect(http.StatusBadRequest, "PATCH", "/v1/reminders/1", token, gin.H{"due": "soon"}, nil)
+		api.expect(http.StatusBadRequest, "PATCH", "/v1/reminders/1", token, []string{"title"}, nil)
+
+		// ids and owners can't be patched
+		api.expect(http.StatusOK, "PATCH", "/v1/reminders/1", token, gin.H{"id": 7, "username": "alex"}, &patched)
+		if patched.ID != 1 || patched.Username != "sam" {
+			t.Fatalf("PATCH id = %+v", patched)
+		}
+		api.expect(http.StatusNotFound, "PATCH", "/v1/reminders/1", other, gin.H{"title": "mine"}, nil)
+
+		var updated reminder
+		api.expect(http.StatusOK, "PUT", "/v1/reminders/1", token, gin.H{"title": "dentist", "due": "2030-01-03T14:00:00+01:00"}, &updated)
+		if updated.Title != "dentist" || updated.Due != "2030-01-03T13:00:00Z" {
+			t.Fatalf("PUT = %+v", updated)
+		}
+
+		api.expect(http.StatusCreated, "POST", "/v1/expenses", token, gin.H{"amount": 12.5, "category": "food", "currency": "EUR", "date": "2030-01-02T12:00:00Z"}, nil)
+		var expense struct {
+			Amount   float64 `json:"amount"`
+			Currency string  `json:"currency"`
+			Category string  `json:"category"`
+		}
+		api.expect(http.StatusOK, "PATCH", "/v1/expenses/1", token, gin.H{"amount": 15}, &expense)
+		if expense.Amount != 15 || expense.Currency != "EUR" || expense.Category != "food" {
+			t.Fatalf("PATCH expense = %+v", expense)
+		}
+
+		api.expect(http.StatusCreated, "POST", "/v1/notes", token, gin.H{"title": "groceries", "content": "milk"}, nil)
+		var note struct {
+			Title   string `json:"title"`
+			Content string `json:"content"`
+		}
+		api.expect(http.StatusOK, "PATCH", "/v1/notes/1", token, gin.H{"content": "milk, eggs"}, &note)
+		api.expect(http.StatusOK, "GET", "/v1/notes/1", token, nil, &note)
+		if note.Title != "groceries" || note.Content != "milk, eggs" {
+			t.Fatalf("note = %+v", note)
+		}
+	})
+}
+
+func TestConditionalRequests(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, api *testAPI) {
+		token := api.signUp("sam")
+
+		// a create hands back everything needed for the next conditional write
+		w := api.send("POST", "/v1/notes", token, nil, gin.H{"title": "groceries", "content": "milk"})
+		var created struct {
+			ID      int    `json:"id"`
+			Version int    `json:"version"`
+			Title   string `json:"title"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &created)
+		if w.Code != http.StatusCreated || created.ID != 1 || created.Version != 1 || created.Title != "groceries" ||
+			w.Header().Get("ETag") != `"1"` || w.Header().Get("Location") != "/v1/notes/1" {
+			t.Fatalf("POST: %d %s, headers %v", w.Code, w.Body, w.Header())
+		}
+
+		ifMatch := func(tag string) http.Header { return http.Header{"If-Match": {tag}} }
+		ifNoneMatch := func(tag string) http.Header { return http.Header{"If-None-Match": {tag}} }
+
+		w = api.send("GET", "/v1/notes/1", token, nil, nil)
+		v1 := w.Header().Get("ETag")
+		if w.Code != http.StatusOK || v1 != `"1"` {
+			t.Fatalf("GET: %d, ETag %q", w.Code, v1)
+		}
+		if w := api.send("GET", "/v1/notes/1", token, ifNoneMatch(v1), nil); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Fatalf("If-None-Match current: %d %q", w.Code, w.Body)
+		}
+
+		// the first device saves; the second still holds version 1
+		w = api.send("PUT", "/v1/notes/1", token, ifMatch(v1), gin.H{"title": "groceries", "content": "milk, eggs"})
+		v2 := w.Header().Get("ETag")
+		if w.Code != http.StatusOK || v2 != `"2"` {
+			t.Fatalf("PUT If-Match current: %d, ETag %q", w.Code, v2)
+		}
+		for _, method := range []string{"PUT", "PATCH", "DELETE"} {
+			w := api.send(method, "/v1/notes/1", token, ifMatch(v1), gin.H{"title": "stale"})
+			if w.Code != http.StatusPreconditionFailed || !strings.Contains(w.Body.String(), apierror.CodeVersionMismatch) {
+				t.Fatalf("%s with a stale If-Match: %d %s", method, w.Code, w.Body)
+			}
+		}
+		if w := api.send("GET", "/v1/notes/1", token, ifNoneMatch(v1), nil); w.Code != http.StatusOK {
+			t.Fatalf("If-None-Match stale: %d", w.Code)
+		}
+
+		// weak tags never satisfy If-Match, * matches any version
+		if w := api.send("PATCH", "/v1/notes/1", token, ifMatch("W/"+v2), gin.H{"title": "x"}); w.Code != http.StatusPreconditionFailed {
+			t.Fatalf("weak If-Match: %d", w.Code)
+		}
+		if w := api.send("PATCH", "/v1/notes/1", token, ifMatch("*"), gin.H{"title": "shopping"}); w.Code != http.StatusOK || w.Header().Get("ETag") != `"3"` {
+			t.Fatalf("If-Match *: %d %q", w.Code, w.Header().Get("ETag"))
+		}
+		if w := api.send("PUT", "/v1/notes/999", token, ifMatch("*"), gin.H{"title": "x"}); w.Code != http.StatusNotFound {
+			t.Fatalf("If-Match on a missing note: %d", w.Code)
+		}
+
+		// lists get a weak tag that changes with their contents
+		w = api.send("GET", "/v1/notes", token, nil, nil)
+		list := w.Header().Get("ETag")
+		if !strings.HasPrefix(list, `W/"`) {
+			t.Fatalf("list ETag %q", list)
+		}
+		if w := api.send("GET", "/v1/notes", token, ifNoneMatch(list), nil); w.Code != http.StatusNotModified {
+			t.Fatalf("list If-None-Match: %d", w.Code)
+		}
+		api.expect(http.StatusOK, "PATCH", "/v1/notes/1", token, gin.H{"content": "bread"}, nil)
+		if w := api.send("GET", "/v1/notes", token, ifNoneMatch(list), nil); w.Code != http.StatusOK {
+			t.Fatalf("list If-None-Match after a change: %d", w.Code)
+		}
+
+		if w := api.send("DELETE", "/v1/notes/1", token, ifMatch(`"4"`), nil); w.Code != http.StatusOK {
+			t.Fatalf("DELETE If-Match current: %d %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("required", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Server.RequireIfMatch = true
+		stores := MemoryStores()
+		api := &testAPI{t: t, router: New(Options{Stores: stores, JWTKey: []byte("test-secret"), Config: cfg}), stores: stores}
+
+		token := api.signUp("sam")
+		api.expect(http.StatusCreated, "POST", "/v1/expenses", token, gin.H{"amount": 5, "category": "food", "date": "2030-01-02T12:00:00Z"}, nil)
+		api.expect(http.StatusPreconditionRequired, "PATCH", "/v1/expenses/1", token, gin.H{"amount": 6}, nil)
+		api.expect(http.StatusPreconditionRequired, "DELETE", "/v1/expenses/1", token, nil, nil)
+		if w := api.send("PATCH", "/v1/expenses/1", token, http.Header{"If-Match": {`"1"`}}, gin.H{"amount": 6}); w.Code != http.StatusOK {
+			t.Fatalf("PATCH with If-Match: %d %s", w.Code, w.Body)
+		}
+	})
+}
+
+func TestIdempotency(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, api *testAPI) {
+		token := api.signUp("sam")
+		key := func(k string) http.Header { return http.Header{idempotency.Header: {k}} }
+		expense := gin.H{"amount": 5, "category": "food", "date": "2030-01-02T12:00:00Z"}
+
+		// the retry gets the first response back without a second expense
+		first := api.send("POST", "/v1/expenses", token, key("a"), expense)
+		retry := api.send("POST", "/v1/expenses", token, key("a"), expense)
+		if first.Code != http.StatusCreated || retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+			t.Fatalf("retry: %d %s, first %d %s", retry.Code, retry.Body, first.Code, first.Body)
+		}
+		if first.Header().Get(idempotency.ReplayedHeader) != "" || retry.Header().Get(idempotency.ReplayedHeader) != "true" {
+			t.Fatalf("%s headers: first %q, retry %q", idempotency.ReplayedHeader, first.Header().Get(idempotency.ReplayedHeader), retry.Header().Get(idempotency.ReplayedHeader))
+		}
+		for _, name := range []string{"Location", "ETag"} {
+			if got, want := retry.Header().Get(name), first.Header().Get(name); want == "" || got != want {
+				t.Fatalf("replayed %s %q, first %q", name, got, want)
+			}
+		}
+
+		// a key belongs to one request and one user
+		if w := api.send("POST", "/v1/expenses", token, key("a"), gin.H{"amount": 6, "category": "food", "date": "2030-01-02T12:00:00Z"}); w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), apierror.CodeIdempotencyReused) {
+			t.Fatalf("reused key: %d %s", w.Code, w.Body)
+		}
+		// but the unversioned alias is the same route
+		if w := api.send("POST", "/expenses", token, key("a"), expense); w.Code != http.StatusCreated || w.Header().Get(idempotency.ReplayedHeader) != "true" {
+			t.Fatalf("retry through the alias: %d %s", w.Code, w.Body)
+		}
+		if w := api.send("POST", "/v1/notes", token, key("a"), expense); w.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("reused key on another route: %d", w.Code)
+		}
+		other := api.signUp("alex")
+		if w := api.send("POST", "/v1/expenses", other, key("a"), expense); w.Code != http.StatusCreated || w.Header().Get(idempotency.ReplayedHeader) != "" {
+			t.Fatalf("another user's key: %d %q", w.Code, w.Header().Get(idempotency.ReplayedHeader))
+		}
+
+		// failed requests aren't kept, so they can be fixed and sent again
+		api.expect(http.StatusBadRequest, "POST", "/v1/expenses", token, gin.H{"amount": 5}, nil)
+		if w := api.send("POST", "/v1/expenses", token, key("b"), gin.H{"amount": 5}); w.Code != http.StatusBadRequest {
+			t.Fatalf("invalid expense: %d", w.Code)
+		}
+		if w := api.send("POST", "/v1/expenses", token, key("b"), expense); w.Code != http.StatusCreated || w.Header().Get(idempotency.ReplayedHeader) != "" {
+			t.Fatalf("after a failed attempt: %d %q", w.Code, w.Header().Get(idempotency.ReplayedHeader))
+		}
+
+		// requests without a key behave as before
+		api.expect(http.StatusCreated, "POST", "/v1/expenses", token, expense, nil)
+		if n := api.send("GET", "/v1/expenses", token, nil, nil).Header().Get(listquery.TotalCountHeader); n != "3" {
+			t.Fatalf("%s expenses, want 3", n)
+		}
+
+		api.expect(http.StatusOK, "DELETE", "/v1/delete", token, nil, nil)
+	})
+}
+
+func TestBatch(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, api *testAPI) {
+		token := api.signUp("sam")
+		expense := gin.H{"amount": 5, "category": "food", "date": "2030-01-02T12:00:00Z"}
+		total := func(resource string) string {
+			return api.send("GET", "/v1/"+resource, token, nil, nil).Header().Get(listquery.TotalCountHeader)
+		}
+
+		var out resource.BatchResponse
+		api.expect(http.StatusOK, "POST", "/v1/batch", token, gin.H{"operations": []gin.H{
+			{"method": "create", "resource": "notes", "body": gin.H{"title": "groceries"}},
+			{"method": "create", "resource": "expenses", "body": expense},
+			{"method": "create", "resource": "expenses", "body": expense},
+		}}, &out)
+		if len(out.Results) != 3 || out.Results[0].Status != http.StatusCreated || out.Results[2].Item.(map[string]any)["id"] != float64(2) {
+			t.Fatalf("results %+v", out.Results)
+		}
+
+		// one failure undoes the whole batch
+		var problem apierror.Problem
+		api.expect(http.StatusPreconditionFailed, "POST", "/v1/batch", token, gin.H{"operations": []gin.H{
+			{"method": "create", "resource": "notes", "body": gin.H{"title": "dentist"}},
+			{"method": "delete", "resource": "expenses", "id": 1},
+			{"method": "update", "resource": "notes", "id": 1, "version": 9, "body": gin.H{"title": "stale"}},
+		}}, &problem)
+		if problem.Code != apierror.CodeVersionMismatch || !strings.HasPrefix(problem.Detail, "operation 2 ") {
+			t.Fatalf("problem %+v", problem)
+		}
+		if total("notes") != "1" || total("expenses") != "2" {
+			t.Fatalf("%s notes and %s expenses after a failed batch, want 1 and 2", total("notes"), total("expenses"))
+		}
+		api.expect(http.StatusBadRequest, "POST", "/v1/batch", token, gin.H{"operations": []gin.H{
+			{"method": "create", "resource": "notes", "body": gin.H{"title": "dentist"}},
+			{"method": "create", "resource": "notes", "body": gin.H{}},
+		}}, &problem)
+		if len(problem.Errors) != 1 || !strings.HasPrefix(problem.Errors[0].Field, "operations[1].") {
+			t.Fatalf("field errors %+v", problem.Errors)
+		}
+
+		// per item, the rest goes through
+		out = resource.BatchResponse{}
+		api.expect(http.StatusOK, "POST", "/v1/batch", token, gin.H{"mode": "per_item", "operations": []gin.H{
+			{"method": "update", "resource": "notes", "id": 1, "version": 1, "body": gin.H{"title": "shopping"}},
+			{"method": "delete", "resource": "expenses", "id": 99},
+			{"method": "delete", "resource": "expenses", "id": 1},
+		}}, &out)
+		if len(out.Results) != 3 || out.Results[0].Item.(map[string]any)["version"] != float64(2) ||
+			out.Results[1].Status != http.StatusNotFound || out.Results[1].Error.Code != apierror.CodeNotFound ||
+			out.Results[2].Status != http.StatusOK {
+			t.Fatalf("results %+v", out.Results)
+		}
+		if total("expenses") != "1" {
+			t.Fatalf("%s expenses, want 1", total("expenses"))
+		}
+
+		// items are still scoped to their owner
+		other := api.signUp("alex")
+		out = resource.BatchResponse{}
+		api.expect(http.StatusOK, "POST", "/v1/batch", other, gin.H{"mode": "per_item", "operations": []gin.H{
+			{"method": "delete", "resource": "notes", "id": 1},
+		}}, &out)
+		if out.Results[0].Status != http.StatusNotFound || total("notes") != "1" {
+			t.Fatalf("deleting another user's note: %+v", out.Results)
+		}
+
+		ops := make([]gin.H, 101)
+		for i := range ops {
+			ops[i] = gin.H{"method": "create", "resource": "notes", "body": gin.H{"title": "x"}}
+		}
+		api.expect(http.StatusBadRequest, "POST", "/v1/batch", token, gin.H{"operations": ops}, nil)
+		api.expect(http.StatusBadRequest, "POST", "/v1/batch", token, gin.H{"operations": []gin.H{{"method": "create", "resource": "users", "body": gin.H{}}}}, nil)
+		api.expect(http.StatusBadRequest, "POST", "/v1/batch", token, gin.H{"operations": []gin.H{}}, nil)
+	})
+}
+
+func TestSearch(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, api *testAPI) {
+		token := api.signUp("sam")
+		api.expect(http.StatusCreated, "POST", "/v1/notes", token, gin.H{"title": "groceries", "content": "buy Milk and eggs"}, nil)
+		api.expect(http.StatusCreated, "POST", "/v1/notes", token, gin.H{"title": "milk prices", "content": "compare shops"}, nil)
+		api.expect(http.StatusCreated, "POST", "/v1/reminders", token, gin.H{"title": "dentist", "due": "2030-01-02T12:00:00Z"}, nil)
+		api.expect(http.StatusCreated, "POST", "/v1/expenses", token, gin.H{"amount": 3, "category": "food", "date": "2030-01-02T12:00:00Z", "note": "milk"}, nil)
+
+		other := api.signUp("alex")
+		api.expect(http.StatusCreated, "POST", "/v1/notes", other, gin.H{"title": "milk"}, nil)
+
+		type results struct {
+			Results    []search.Hit `json:"results"`
+			NextCursor string       `json:"next_cursor"`
+		}
+
+		// titles outrank bodies, and only the user's own items come back
+		var out results
+		api.expect(http.StatusOK, "GET", "/v1/search?q=milk", token, nil, &out)
+		if len(out.Results) != 3 || out.Results[0].Type != "notes" || out.Results[0].ID != 2 {
+			t.Fatalf("results %+v", out.Results)
+		}
+		for _, hit := range out.Results {
+			if !strings.Contains(strings.ToLower(hit.Snippet), "<mark>milk</mark>") {
+				t.Fatalf("snippet %q doesn't mark milk", hit.Snippet)
+			}
+		}
+
+		out = results{}
+		api.expect(http.StatusOK, "GET", "/v1/search?q=milk&type=expenses,reminders", token, nil, &out)
+		if len(out.Results) != 1 || out.Results[0].Type != "expenses" || out.Results[0].Title != "food" {
+			t.Fatalf("expenses only: %+v", out.Results)
+		}
+
+		out = results{}
+		api.expect(http.StatusOK, "GET", "/v1/search?q=milk+eggs", token, nil, &out)
+		if len(out.Results) != 1 || out.Results[0].ID != 1 {
+			t.Fatalf("every word: %+v", out.Results)
+		}
+
+		// paging
+		w := api.send("GET", "/v1/search?q=milk&limit=2", token, nil, nil)
+		out = results{}
+		json.Unmarshal(w.Body.Bytes(), &out)
+		if len(out.Results) != 2 || out.NextCursor == "" || w.Header().Get(listquery.TotalCountHeader) != "3" {
+			t.Fatalf("first page: %+v, total %q", out, w.Header().Get(listquery.TotalCountHeader))
+		}
+		var rest results
+		api.expect(http.StatusOK, "GET", "/v1/search?q=milk&limit=2&cursor="+out.NextCursor, token, nil, &rest)
+		if len(rest.Results) != 1 || rest.NextCursor != "" || rest.Results[0] == out.Results[0] || rest.Results[0] == out.Results[1] {
+			t.Fatalf("second page: %+v", rest)
+		}
+
+		api.expect(http.StatusBadRequest, "GET", "/v1/search?q=eggs&cursor="+out.NextCursor, token, nil, nil)
+		api.expect(http.StatusBadRequest, "GET", "/v1/search?q=", token, nil, nil)
+		api.expect(http.StatusBadRequest, "GET", "/v1/search?q=milk&type=users", token, nil, nil)
+		api.expect(http.StatusUnauthorized, "GET", "/v1/search?q=milk", "", nil, nil)
+	})
+}
+
+func TestListQuery(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, api *testAPI) {
+		token := api.signUp("sam")
+
+		for _, e := range []gin.H{
+			{"amount": 5, "category": "food", "date": "2030-01-03T12:00:00Z"},
+			{"amount": 40, "category": "travel", "date": "2030-01-01T12:00:00Z"},
+			{"amount": 12, "category": "food", "date": "2030-01-05T12:00:00+02:00"},
+			{"amount": 8, "category": "food", "date": "2030-01-02T12:00:00Z"},
+			{"amount": 20, "category": "rent", "date": "2030-01-04T12:00:00Z"},
+		} {
+			api.expect(http.StatusCreated, "POST", "/v1/expenses", token, e, nil)
+		}
+
+		type page struct {
+			Expenses []struct {
+				Amount float64 `json:"amount"`
+				Date   string  `json:"date"`
+			} `json:"expenses"`
+			NextCursor string `json:"next_cursor"`
+		}
+
+		get := func(path string) (page, http.Header) {
+			t.Helper()
+
+			req := httptest.NewRequest("GET", path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			api.router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %s: status %d: %s", path, w.Code, w.Body)
+			}
+
+			var p page
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			return p, w.Header()
+		}
+
+		// newest first, two at a time
+		var amounts []float64
+		path := "/v1/expenses?sort=-date&limit=2"
+		for pages := 0; path != ""; pages++ {
+			if pages > 3 {
+				t.Fatal("cursor never ran out")
+			}
+			p, h := get(path)
+			if h.Get("X-Total-Count") != "5" {
+				t.Fatalf("X-Total-Count = %q, want 5", h.Get("X-Total-Count"))
+			}
+			for _, e := range p.Expenses {
+				amounts = append(amounts, e.Amount)
+			}
+			path = ""
+			if p.NextCursor != "" {
+				path = "/v1/expenses?sort=-date&limit=2&cursor=" + p.NextCursor
+				if !strings.Contains(h.Get("Link"), `rel="next"`) {
+					t.Fatalf("missing next link: %q", h.Get("Link"))
+				}
+			}
+		}
+		if fmt.Sprint(amounts) != "[12 20 5 8 40]" {
+			t.Fatalf("paged amounts %v", amounts)
+		}
+
+		p, h := get("/v1/expenses?category=food&date[gte]=2030-01-03T00:00:00Z&sort=amount")
+		if h.Get("X-Total-Count") != "2" || len(p.Expenses) != 2 || p.Expenses[0].Amount != 5 || p.Expenses[1].Amount != 12 {
+			t.Fatalf("filtered %+v, total %s", p.Expenses, h.Get("X-Total-Count"))
+		}
+		if p.Expenses[1].Date != "2030-01-05T10:00:00Z" {
+			t.Fatalf("date stored as %q, want UTC", p.Expenses[1].Date)
+		}
+
+		p, _ = get("/v1/expenses?amount[lt]=10&amount[gte]=8")
+		if len(p.Expenses) != 1 || p.Expenses[0].Amount != 8 {
+			t.Fatalf("amount range %+v", p.Expenses)
+		}
+
+		// parameters that aren't filters are ignored, but anything shaped like
+		// one must name a field
+		if p, _ := get("/v1/expenses?_=1700000000&utm_source=mail"); len(p.Expenses) != 5 {
+			t.Fatalf("unknown parameters changed the list: %+v", p.Expenses)
+		}
+		for _, bad := range []string{"sort=note", "note[eq]=x", "notes[gte]=1", "category[gt]=a", "date[gte]=soon", "limit=0", "limit=1000", "cursor=nope"} {
+			api.expect(http.StatusBadRequest, "GET", "/v1/expenses?"+bad, token, nil, nil)
+		}
+
+		// a cursor only works with the sort it was issued for
+		p, _ = get("/v1/expenses?sort=amount&limit=1")
+		api.expect(http.StatusBadRequest, "GET", "/v1/expenses?sort=date&cursor="+p.NextCursor, token, nil, nil)
+
+		api.expect(http.StatusCreated, "POST", "/v1/reminders", token, gin.H{"title": "dentist", "due": "2030-01-02T14:00:00Z"}, nil)
+		api.expect(http.StatusCreated, "POST", "/v1/reminders", token, gin.H{"title": "passport", "due": "2030-06-01T09:00:00Z"}, nil)
+		var reminders struct {
+			Reminders []struct {
+				Title string `json:"title"`
+			} `json:"reminders"`
+		}
+		api.expect(http.StatusOK, "GET", "/v1/reminders?due[lt]=2030-03-01T00:00:00Z", token, nil, &reminders)
+		if len(reminders.Reminders) != 1 || reminders.Reminders[0].Title != "dentist" {
+			t.Fatalf("due filter %+v", reminders.Reminders)
+		}
+
+		api.expect(http.StatusCreated, "POST", "/v1/notes", token, gin.H{"title": "first"}, nil)
+		api.expect(http.StatusCreated, "POST", "/v1/notes", token, gin.H{"title": "second"}, nil)
+		var notes struct {
+			Notes []struct {
+				Title string `json:"title"`
+			} `json:"notes"`
+		}
+		api.expect(http.StatusOK, "GET", "/v1/notes?sort=-created_at", token, nil, &notes)
+		if len(notes.Notes) != 2 || notes.Notes[0].Title != "second" {
+			t.Fatalf("newest notes first %+v", notes.Notes)
+		}
+	})
+}
+
+func TestLeaderboard(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, api *testAPI) {
+		user := api.signUp("sam")
+		admin := api.admin()
+
+		api.expect(http.StatusForbidden, "POST", "/v1/admin/leaderboard", user, gin.H{"section": "a", "name": "team", "points": 1}, nil)
+		api.expect(http.StatusBadRequest, "POST", "/v1/admin/leaderboard", admin, gin.H{"section": "a", "name": "team", "points": -1}, nil)
+
+		api.expect(http.StatusCreated, "POST", "/v1/admin/leaderboard", admin, gin.H{"section": "a", "name": "red", "points": 10}, nil)
+		api.expect(http.StatusCreated, "POST", "/v1/admin/leaderboard", admin, gin.H{"section": "a", "name": "blue", "points": 30}, nil)
+		api.expect(http.StatusCreated, "POST", "/v1/admin/leaderboard", admin, gin.H{"section": "b", "name": "green", "points": 50}, nil)
+
+		type entry struct {
+			ID     int    `json:"id"`
+			Name   string `json:"name"`
+			Points int    `json:"points"`
+			Rank   int    `json:"rank"`
+		}
+
+		type page struct {
+			Entries    []entry `json:"entries"`
+			NextCursor string  `json:"next_cursor"`
+		}
+		var p page
+		api.expect(http.StatusOK, "GET", "/v1/leaderboard/a", "", nil, &p)
+		entries := p.Entries
+		if len(entries) != 2 || entries[0].Name != "blue" || entries[0].Rank != 1 || entries[1].Rank != 2 {
+			t.Fatalf("unexpected leaderboard %+v", entries)
+		}
+
+		// ranks carry on across pages
+		api.expect(http.StatusOK, "GET", "/v1/leaderboard/a?limit=1", "", nil, &p)
+		if len(p.Entries) != 1 || p.Entries[0].Name != "blue" || p.NextCursor == "" {
+			t.Fatalf("first page %+v", p)
+		}
+		cursor := p.NextCursor
+		p = page{}
+		api.expect(http.StatusOK, "GET", "/v1/leaderboard/a?limit=1&cursor="+cursor, "", nil, &p)
+		if len(p.Entries) != 1 || p.Entries[0].Name != "red" || p.Entries[0].Rank != 2 || p.NextCursor != "" {
+			t.Fatalf("second page %+v", p)
+		}
+		api.expect(http.StatusBadRequest, "GET", "/v1/leaderboard/a?sort=name", "", nil, nil)
+
+		red := "/v1/admin/leaderboard/" + strconv.Itoa(entries[1].ID)
+
+		api.expect(http.StatusForbidden, "PUT", red, user, gin.H{"section": "a", "name": "red", "points": 100}, nil)
+		api.expect(http.StatusOK, "PUT", red, admin, gin.H{"section": "a", "name": "red", "points": 100}, nil)
+		api.expect(http.StatusNotFound, "PUT", "/v1/admin/leaderboard/999", admin, gin.H{"section": "a", "name": "x", "points": 1}, nil)
+
+		api.expect(http.StatusOK, "GET", "/v1/leaderboard/a", "", nil, &p)
+		if entries = p.Entries; entries[0].Name != "red" {
+			t.Fatalf("update did not reorder leaderboard %+v", entries)
+		}
+
+		api.expect(http.StatusForbidden, "DELETE", red, user, nil, nil)
+		api.expect(http.StatusOK, "DELETE", red, admin, nil, nil)
+		api.expect(http.StatusNotFound, "DELETE", red, admin, nil, nil)
+
+		api.expect(http.StatusOK, "GET", "/v1/leaderboard/a", "", nil, &p)
+		if len(p.Entries) != 1 {
+			t.Fatalf("got %d entries after delete, want 1", len(p.Entries))
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/z-sk1/signin-api/internal/apierror"
+)
+
+// Routes registers one resource's endpoints on an API version's group
+type Routes func(g *gin.RouterGroup)
+
+// APIVersion is the set of resources served under /<Name>
+type APIVersion struct {
+	Name      string
+	Resources map[string]Routes
+	// Deprecation, when set, retires the whole version
+	Deprecation *Deprecation
+}
+
+// Next returns a version serving the same resources as v, except that each
+// entry in changes replaces that resource's routes, or drops the resource
+// when it's nil. A v2 that only changes notes would be
+//
+//	v2 := v1.Next("v2", map[string]Routes{"notes": notesV2})
+func (v APIVersion) Next(name string, changes map[string]Routes) APIVersion {
+	next := APIVersion{Name: name, Resources: map[string]Routes{}}
+	for resource, routes := range v.Resources {
+		next.Resources[resource] = routes
+	}
+	for resource, routes := range changes {
+		if routes == nil {
+			delete(next.Resources, resource)
+		} else {
+			next.Resources[resource] = routes
+		}
+	}
+	return next
+}
+
+// mount registers every resource of v on g, in a fixed order
+func (v APIVersion) mount(g *gin.RouterGroup) {
+	if v.Deprecation != nil {
+		g.Use(Deprecated(*v.Deprecation))
+	}
+
+	names := make([]string, 0, len(v.Resources))
+	for name := range v.Resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		v.Resources[name](g)
+	}
+}
+
+// Deprecation describes a retired route or version
+type Deprecation struct {
+	// Since is when it was deprecated
+	Since time.Time
+	// Sunset is when it stops being served; zero if that isn't scheduled
+	Sunset time.Time
+	// Successor maps a request path to its replacement, for the Link header
+	Successor func(path string) string
+}
+
+// Deprecated marks responses with the Deprecation (RFC 9745) and Sunset
+// (RFC 8594) headers, and answers 410 Gone once the sunset has passed
+func Deprecated(d Deprecation) gin.HandlerFunc {
+	deprecation := "@" + strconv.FormatInt(d.Since.Unix(), 10)
+
+	return func(c *gin.Context) {
+		h := c.Writer.Header()
+		h.Set("Deprecation", deprecation)
+		if !d.Sunset.IsZero() {
+			h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if d.Successor != nil {
+			h.Add("Link", "<"+d.Successor(c.Request.URL.Path)+`>; rel="successor-version"`)
+		}
+
+		if !d.Sunset.IsZero() && time.Now().After(d.Sunset) {
+			apierror.Abort(c, apierror.New(http.StatusGone, apierror.CodeRetired, "this endpoint has been retired"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+var versionPrefix = regexp.MustCompile(`^/v[0-9]+(/|$)`)
+
+// unversioned strips a leading /v1, /v2... from path
+func unversioned(path string) string {
+	if loc := versionPrefix.FindStringIndex(path); loc != nil {
+		return "/" + strings.TrimPrefix(path[loc[1]:], "/")
+	}
+	return path
+}
@@ -0,0 +1,49 @@
+package validation
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var once sync.Once
+
+// Register adds the custom binding tags to gin's validator and makes its
+// errors name fields by their JSON key. It's safe to call more than once
+//
+//	rfc3339   string is an RFC 3339 timestamp
+//	currency  string is an ISO 4217 currency code such as "USD"
+func Register() {
+	once.Do(func() {
+		v, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			return
+		}
+
+		v.RegisterTagNameFunc(jsonName)
+		if err := v.RegisterValidation("rfc3339", rfc3339); err != nil {
+			panic(err)
+		}
+		v.RegisterAlias("currency", "iso4217")
+	})
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+func rfc3339(fl validator.FieldLevel) bool {
+	_, err := time.Parse(time.RFC3339, fl.Field().String())
+	return err == nil
+}
@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/z-sk1/signin-api/internal/metrics"
+)
+
+// Group runs periodic background jobs that all stop when their context ends
+type Group struct {
+	wg sync.WaitGroup
+}
+
+// Every runs job once per interval until ctx is cancelled. A failing run is
+// logged and retried on the next tick
+func (g *Group) Every(ctx context.Context, name string, interval time.Duration, job func(ctx context.Context) error) {
+	g.wg.Add(1)
+
+	go func() {
+		defer g.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				metrics.JobsInFlight.Inc()
+				err := job(ctx)
+				metrics.JobsInFlight.Dec()
+
+				if err != nil && ctx.Err() == nil {
+					metrics.JobRuns.WithLabelValues(name, "error").Inc()
+					slog.Error("background job failed", "worker", name, "error", err)
+				} else if err == nil {
+					metrics.JobRuns.WithLabelValues(name, "success").Inc()
+				}
+			}
+		}
+	}()
+}
+
+// Wait blocks until every job has returned
+func (g *Group) Wait() {
+	g.wg.Wait()
+}
@@ -1,86 +1,163 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
 	"github.com/z-sk1/signin-api/internal/auth"
-	leaderboard "github.com/z-sk1/signin-api/internal/bateenfest"
+	"github.com/z-sk1/signin-api/internal/config"
 	"github.com/z-sk1/signin-api/internal/db"
-	"github.com/z-sk1/signin-api/internal/keep-track/expenses"
-	"github.com/z-sk1/signin-api/internal/remind-me/notes"
-	"github.com/z-sk1/signin-api/internal/remind-me/reminders"
+	"github.com/z-sk1/signin-api/internal/health"
+	"github.com/z-sk1/signin-api/internal/logging"
+	"github.com/z-sk1/signin-api/internal/metrics"
+	"github.com/z-sk1/signin-api/internal/server"
+	"github.com/z-sk1/signin-api/internal/tracing"
+	"github.com/z-sk1/signin-api/internal/worker"
 )
 
 func main() {
-	db.InitDB()
-
-	r := gin.Default()
-
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"}, // or ["http://localhost:5173"] if you want to be strict
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
-
-	// auth routes
-	r.POST("/signup", auth.SignUp)
-	r.POST("/login", auth.Login)
-	r.POST("/forgot-password", auth.ForgotPassword)
-	r.POST("/reset-password", auth.ResetPassword)
-
-	// unprotected routes
-	r.GET("/leaderboard/:section", leaderboard.GetAllLeaderboardScores)
-
-	// protected routes
-	authRoutes := r.Group("/")
-	authRoutes.Use(auth.RequireAuth)
-	{
-		authRoutes.GET("/me", auth.Me)
-		authRoutes.DELETE("/delete", auth.DeleteAccount)
-
-		// admin
-		adminRoutes := authRoutes.Group("/admin")
-		adminRoutes.Use(auth.RequireAdmin)
-		{
-			adminRoutes.POST("/leaderboard", leaderboard.AddLeaderboardScore)
-			adminRoutes.DELETE("/leaderboard/:id", leaderboard.DeleteLeaderboardScore)
-			adminRoutes.PUT("/leaderboard/:id", leaderboard.UpdateLeaderboardScore)
+	cfg, args, err := config.Load(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprint(os.Stderr, "\n"+usage)
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if len(args) > 0 {
+		runCommand(cfg, args)
+		return
+	}
+
+	mustValidate(cfg)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatal("Failed to set up tracing: ", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	db.InitDB(cfg.Database)
+	defer db.DB.Close()
+
+	// SIGTERM starts a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	metrics.RegisterDB(db.DB.DB, "main")
+
+	stores := server.SQLStores(db.DB)
+	setupToken := bootstrapAdmin(context.Background(), cfg.Admin, stores.Users)
+
+	checker := health.NewChecker()
+	checker.Register("database", db.DB.PingContext)
+	checker.Register("migrations", func(ctx context.Context) error {
+		pending, err := db.DB.PendingMigrations(ctx)
+		if err != nil {
+			return err
 		}
+		if pending > 0 {
+			return fmt.Errorf("%d pending", pending)
+		}
+		return nil
+	})
+
+	r := server.New(server.Options{
+		Stores: stores,
+		JWTKey: auth.LoadOrCreateSecret(cfg.Auth.SecretFile),
+		Config: cfg,
+		Health: checker,
+
+		SetupToken: setupToken,
+	})
 
-		// notes
-		authRoutes.POST("/notes", notes.CreateNote)
-		authRoutes.GET("/notes", notes.GetAllNotes)
-		authRoutes.GET("/notes/total", notes.GetNoteCount)
-		authRoutes.DELETE("/notes/:id", notes.DeleteNote)
-		authRoutes.PUT("/notes/:id", notes.UpdateNote)
-
-		// reminders
-		authRoutes.POST("/reminders", reminders.CreateReminder)
-		authRoutes.GET("/reminders", reminders.GetAllReminders)
-		authRoutes.GET("/reminders/total", reminders.GetReminderCount)
-		authRoutes.DELETE("/reminders/:id", reminders.DeleteReminder)
-		authRoutes.PUT("/reminders/:id", reminders.UpdateReminder)
-
-		// expenses
-		authRoutes.POST("/expenses", expenses.CreateExpense)
-
-		authRoutes.GET("/expenses", expenses.GetAllExpenses)
-		authRoutes.GET("/expenses/total", expenses.GetTotalExpenses)
-		authRoutes.GET("/expenses/categories", expenses.GetExpenseCategories)
-		authRoutes.DELETE("/expenses/:id", expenses.DeleteExpense)
-		authRoutes.PUT("/expenses/:id", expenses.UpdateExpense)
+	var workers worker.Group
+	workers.Every(ctx, "purge-expired-resets", 10*time.Minute, func(ctx context.Context) error {
+		_, err := stores.Users.PurgeExpiredResets(ctx, time.Now().Unix())
+		return err
+	})
+	workers.Every(ctx, "purge-expired-idempotency-keys", 10*time.Minute, func(ctx context.Context) error {
+		_, err := stores.Idempotency.PurgeExpired(ctx, time.Now().Unix())
+		return err
+	})
+
+	err = server.Serve(ctx, r, server.ServeOptions{
+		Addr:              ":" + strconv.Itoa(cfg.Server.Port),
+		ReadTimeout:       cfg.Server.ReadTimeout.Duration,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout.Duration,
+		WriteTimeout:      cfg.Server.WriteTimeout.Duration,
+		IdleTimeout:       cfg.Server.IdleTimeout.Duration,
+		ShutdownTimeout:   cfg.Server.ShutdownTimeout.Duration,
+		DrainDelay:        cfg.Server.DrainDelay.Duration,
+		OnShutdown:        checker.Drain,
+		TLSCertFile:       cfg.Server.TLSCertFile,
+		TLSKeyFile:        cfg.Server.TLSKeyFile,
+		HTTP3:             cfg.Server.HTTP3,
+	})
+
+	// stop background workers whether we got here by signal or by error
+	stop()
+	workers.Wait()
+
+	if err != nil {
+		slog.Error("server error", "error", err)
+		db.DB.Close()
+		os.Exit(1)
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	slog.Info("server stopped")
+}
+
+// bootstrapAdmin creates the configured admin if no admin exists yet. Without
+// one configured it returns a one-time token for POST /setup instead, or ""
+// when the instance already has an admin
+func bootstrapAdmin(ctx context.Context, admin config.Admin, users auth.Repository) string {
+	exists, err := users.AdminExists(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if exists {
+		return ""
 	}
 
-	r.Run(":" + port)
+	if admin.Seeded() {
+		password, err := admin.LoadPassword()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = auth.CreateFirstAdmin(ctx, users, auth.User{Username: admin.Username, Email: admin.Email, Password: password})
+		if err != nil && !errors.Is(err, auth.ErrAdminExists) {
+			log.Fatal("Failed to create admin account: ", err)
+		}
+
+		slog.Info("admin account created", "username", admin.Username)
+		return ""
+	}
+
+	token := auth.NewSetupToken()
+	// printed directly: the logger would redact it as a token
+	fmt.Fprintf(os.Stderr, "No admin account exists. Create one with POST /setup using setup token %s, or run signin-api bootstrap-admin\n", token)
+	return token
+}
+
+// setupLogging makes the configured slog logger the default. The standard
+// log package writes through it too, so older log calls get the same format
+func setupLogging(cfg *config.Config) {
+	logger, err := logging.New(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
 }
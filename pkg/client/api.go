@@ -0,0 +1,364 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// probes
+
+// Health reports whether the API process is up
+func (c *Client) Health(ctx context.Context) error {
+	return c.send(ctx, http.MethodGet, "/healthz", "", nil, nil)
+}
+
+// Ready reports whether the API can serve traffic, including its database
+func (c *Client) Ready(ctx context.Context) error {
+	return c.send(ctx, http.MethodGet, "/readyz", "", nil, nil)
+}
+
+func (c *Client) Version(ctx context.Context) (*BuildInfo, error) {
+	var out BuildInfo
+	if err := c.send(ctx, http.MethodGet, "/version", "", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// accounts
+
+func (c *Client) SignUp(ctx context.Context, username, email, password string) error {
+	body := map[string]string{"username": username, "email": email, "password": password}
+	return c.send(ctx, http.MethodPost, "/v1/signup", "", body, nil)
+}
+
+// ForgotPassword starts a reset for email. The API currently returns the
+// reset token directly, which is passed back here
+func (c *Client) ForgotPassword(ctx context.Context, email string) (string, error) {
+	var out struct {
+		ResetToken string `json:"reset_token"`
+	}
+	err := c.send(ctx, http.MethodPost, "/v1/forgot-password", "", map[string]string{"email": email}, &out)
+	return out.ResetToken, err
+}
+
+func (c *Client) ResetPassword(ctx context.Context, token, password string) error {
+	body := map[string]string{"token": token, "password": password}
+	return c.send(ctx, http.MethodPost, "/v1/reset-password", "", body, nil)
+}
+
+// Setup creates the first admin account
+func (c *Client) Setup(ctx context.Context, req SetupRequest) error {
+	return c.send(ctx, http.MethodPost, "/v1/setup", "", req, nil)
+}
+
+func (c *Client) Me(ctx context.Context) (*Profile, error) {
+	var out Profile
+	if err := c.call(ctx, http.MethodGet, "/v1/me", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteAccount deletes the signed-in account and forgets the client's token
+func (c *Client) DeleteAccount(ctx context.Context) error {
+	if err := c.call(ctx, http.MethodDelete, "/v1/delete", nil, nil); err != nil {
+		return err
+	}
+	c.setToken("")
+	return nil
+}
+
+// list fetches every page of a list route, following next_cursor. query
+// takes the route's sort and filter parameters, e.g.
+//
+//	url.Values{"sort": {"-date"}, "category": {"food"}, "date[gte]": {"2030-01-01T00:00:00Z"}}
+func list[T any](ctx context.Context, c *Client, path, key string, query url.Values) ([]T, error) {
+	values := url.Values{}
+	for k, v := range query {
+		values[k] = v
+	}
+	if values.Get("limit") == "" {
+		values.Set("limit", strconv.Itoa(pageSize))
+	}
+
+	items := []T{}
+	for {
+		var page map[string]json.RawMessage
+		if err := c.call(ctx, http.MethodGet, path+"?"+values.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+
+		var batch []T
+		if err := json.Unmarshal(page[key], &batch); err != nil {
+			return nil, err
+		}
+		items = append(items, batch...)
+
+		var next string
+		if raw, ok := page["next_cursor"]; ok {
+			if err := json.Unmarshal(raw, &next); err != nil {
+				return nil, err
+			}
+		}
+		if next == "" {
+			return items, nil
+		}
+		values.Set("cursor", next)
+	}
+}
+
+// pageSize is the largest page the API serves
+const pageSize = 200
+
+// notes
+
+// CreateNote returns the note as saved, with its id and version
+func (c *Client) CreateNote(ctx context.Context, note Note) (*Note, error) {
+	var out Note
+	if err := c.call(ctx, http.MethodPost, "/v1/notes", note, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListNotes returns every note matching query, which may be nil. See list
+func (c *Client) ListNotes(ctx context.Context, query url.Values) ([]Note, error) {
+	return list[Note](ctx, c, "/v1/notes", "notes", query)
+}
+
+func (c *Client) CountNotes(ctx context.Context) (int, error) {
+	var out struct {
+		Total int `json:"total"`
+	}
+	err := c.call(ctx, http.MethodGet, "/v1/notes/total", nil, &out)
+	return out.Total, err
+}
+
+func (c *Client) GetNote(ctx context.Context, id int) (*Note, error) {
+	var out Note
+	if err := c.call(ctx, http.MethodGet, "/v1/notes/"+strconv.Itoa(id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateNote replaces every field of a note and returns it as saved. A
+// non-zero note.Version makes it fail with ErrVersionMismatch if the note has
+// changed since
+func (c *Client) UpdateNote(ctx context.Context, id int, note Note) (*Note, error) {
+	var out Note
+	if err := c.call(ifMatch(ctx, note.Version), http.MethodPut, "/v1/notes/"+strconv.Itoa(id), note, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PatchNote changes only the fields in patch, keyed by their JSON names; a
+// nil value clears a field
+func (c *Client) PatchNote(ctx context.Context, id int, patch map[string]any) (*Note, error) {
+	var out Note
+	if err := c.call(ctx, http.MethodPatch, "/v1/notes/"+strconv.Itoa(id), patch, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteNote(ctx context.Context, id int) error {
+	return c.call(ctx, http.MethodDelete, "/v1/notes/"+strconv.Itoa(id), nil, nil)
+}
+
+// reminders
+
+func (c *Client) CreateReminder(ctx context.Context, reminder Reminder) (*Reminder, error) {
+	var out Reminder
+	if err := c.call(ctx, http.MethodPost, "/v1/reminders", reminder, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListReminders returns every reminder matching query, which may be nil. See list
+func (c *Client) ListReminders(ctx context.Context, query url.Values) ([]Reminder, error) {
+	return list[Reminder](ctx, c, "/v1/reminders", "reminders", query)
+}
+
+func (c *Client) CountReminders(ctx context.Context) (int, error) {
+	var out struct {
+		Total int `json:"total"`
+	}
+	err := c.call(ctx, http.MethodGet, "/v1/reminders/total", nil, &out)
+	return out.Total, err
+}
+
+func (c *Client) GetReminder(ctx context.Context, id int) (*Reminder, error) {
+	var out Reminder
+	if err := c.call(ctx, http.MethodGet, "/v1/reminders/"+strconv.Itoa(id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateReminder replaces every field of a reminder and returns it as saved. A
+// non-zero reminder.Version makes it fail with ErrVersionMismatch if the reminder has
+// changed since
+func (c *Client) UpdateReminder(ctx context.Context, id int, reminder Reminder) (*Reminder, error) {
+	var out Reminder
+	if err := c.call(ifMatch(ctx, reminder.Version), http.MethodPut, "/v1/reminders/"+strconv.Itoa(id), reminder, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PatchReminder changes only the fields in patch, keyed by their JSON names; a
+// nil value clears a field
+func (c *Client) PatchReminder(ctx context.Context, id int, patch map[string]any) (*Reminder, error) {
+	var out Reminder
+	if err := c.call(ctx, http.MethodPatch, "/v1/reminders/"+strconv.Itoa(id), patch, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteReminder(ctx context.Context, id int) error {
+	return c.call(ctx, http.MethodDelete, "/v1/reminders/"+strconv.Itoa(id), nil, nil)
+}
+
+// expenses
+
+func (c *Client) CreateExpense(ctx context.Context, expense Expense) (*Expense, error) {
+	var out Expense
+	if err := c.call(ctx, http.MethodPost, "/v1/expenses", expense, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListExpenses returns every expense matching query, which may be nil. See list
+func (c *Client) ListExpenses(ctx context.Context, query url.Values) ([]Expense, error) {
+	return list[Expense](ctx, c, "/v1/expenses", "expenses", query)
+}
+
+func (c *Client) TotalExpenses(ctx context.Context) (float64, error) {
+	var out struct {
+		Total float64 `json:"total"`
+	}
+	err := c.call(ctx, http.MethodGet, "/v1/expenses/total", nil, &out)
+	return out.Total, err
+}
+
+func (c *Client) ExpenseCategories(ctx context.Context) ([]CategoryTotal, error) {
+	var out struct {
+		Categories []CategoryTotal `json:"categories"`
+	}
+	err := c.call(ctx, http.MethodGet, "/v1/expenses/categories", nil, &out)
+	return out.Categories, err
+}
+
+func (c *Client) GetExpense(ctx context.Context, id int) (*Expense, error) {
+	var out Expense
+	if err := c.call(ctx, http.MethodGet, "/v1/expenses/"+strconv.Itoa(id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateExpense replaces every field of a expense and returns it as saved. A
+// non-zero expense.Version makes it fail with ErrVersionMismatch if the expense has
+// changed since
+func (c *Client) UpdateExpense(ctx context.Context, id int, expense Expense) (*Expense, error) {
+	var out Expense
+	if err := c.call(ifMatch(ctx, expense.Version), http.MethodPut, "/v1/expenses/"+strconv.Itoa(id), expense, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PatchExpense changes only the fields in patch, keyed by their JSON names; a
+// nil value clears a field
+func (c *Client) PatchExpense(ctx context.Context, id int, patch map[string]any) (*Expense, error) {
+	var out Expense
+	if err := c.call(ctx, http.MethodPatch, "/v1/expenses/"+strconv.Itoa(id), patch, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteExpense(ctx context.Context, id int) error {
+	return c.call(ctx, http.MethodDelete, "/v1/expenses/"+strconv.Itoa(id), nil, nil)
+}
+
+// batch
+
+// Batch runs ops in one transaction. By default a failing op fails the call
+// and nothing is applied; with perItem every op that can be applied is, and
+// each result carries its own error
+func (c *Client) Batch(ctx context.Context, ops []BatchOp, perItem bool) ([]BatchResult, error) {
+	req := struct {
+		Mode       string    `json:"mode,omitempty"`
+		Operations []BatchOp `json:"operations"`
+	}{Operations: ops}
+	if perItem {
+		req.Mode = "per_item"
+	}
+
+	var out struct {
+		Results []BatchResult `json:"results"`
+	}
+	err := c.call(ctx, http.MethodPost, "/v1/batch", req, &out)
+	return out.Results, err
+}
+
+// search
+
+// Search returns the best hits for text among the notes, reminders and
+// expenses of the signed-in user, up to searchLimit of them. types narrows
+// the search, e.g. "notes"
+func (c *Client) Search(ctx context.Context, text string, types ...string) ([]SearchHit, error) {
+	values := url.Values{"q": {text}, "limit": {strconv.Itoa(searchLimit)}}
+	if len(types) > 0 {
+		values.Set("type", strings.Join(types, ","))
+	}
+
+	var out struct {
+		Results []SearchHit `json:"results"`
+	}
+	err := c.call(ctx, http.MethodGet, "/v1/search?"+values.Encode(), nil, &out)
+	return out.Results, err
+}
+
+// searchLimit is the largest page of hits the API serves
+const searchLimit = 100
+
+// leaderboard
+
+// Leaderboard returns every entry in a section, highest first
+func (c *Client) Leaderboard(ctx context.Context, section string) ([]LeaderboardEntry, error) {
+	return list[LeaderboardEntry](ctx, c, "/v1/leaderboard/"+url.PathEscape(section), "entries", nil)
+}
+
+// AddScore, UpdateScore and DeleteScore need an admin account
+
+func (c *Client) AddScore(ctx context.Context, entry LeaderboardEntry) error {
+	return c.call(ctx, http.MethodPost, "/v1/admin/leaderboard", entry, nil)
+}
+
+func (c *Client) UpdateScore(ctx context.Context, id int, entry LeaderboardEntry) error {
+	return c.call(ctx, http.MethodPut, "/v1/admin/leaderboard/"+strconv.Itoa(id), entry, nil)
+}
+
+func (c *Client) DeleteScore(ctx context.Context, id int) error {
+	return c.call(ctx, http.MethodDelete, "/v1/admin/leaderboard/"+strconv.Itoa(id), nil, nil)
+}
+
+// Config returns the server's effective configuration with secrets redacted.
+// It needs an admin account
+func (c *Client) Config(ctx context.Context) (json.RawMessage, error) {
+	var out json.RawMessage
+	err := c.call(ctx, http.MethodGet, "/v1/admin/config", nil, &out)
+	return out, err
+}
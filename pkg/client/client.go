@@ -0,0 +1,316 @@
+// Package client is a typed Go client for signin-api.
+//
+// A Client given credentials logs in on first use and logs in again when the
+// API rejects its token, so callers never handle tokens themselves. Reads,
+// updates and deletes are retried with backoff on network errors and
+// temporary server failures. Writes made against a Version are not: had the
+// first attempt gone through, the retry would fail with ErrVersionMismatch.
+// Creates carry an Idempotency-Key but are only retried WithRetriedCreates,
+// since an API with idempotency turned off would run each attempt.
+//
+//	c := client.New("https://api.example.com", client.WithCredentials("sam", "hunter22"))
+//	notes, err := c.ListNotes(ctx, url.Values{"sort": {"-created_at"}})
+//	if errors.Is(err, client.ErrUnauthorized) { ... }
+package client
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client calls the API at a base URL. It's safe for concurrent use
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+
+	login    string
+	password string
+
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	// retryCreates retries POSTs, trusting the API to honour their key
+	retryCreates bool
+
+	mu    sync.Mutex
+	token string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sends requests through hc instead of http.DefaultClient
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithCredentials logs in as login (a username or email) whenever the client
+// has no token or its token stops working
+func WithCredentials(login, password string) Option {
+	return func(c *Client) { c.login, c.password = login, password }
+}
+
+// WithToken starts the client with an existing token
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithRetries sets how many times calls are retried and the backoff before
+// the first retry, which doubles up to a few seconds
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) { c.maxRetries, c.minBackoff = n, backoff }
+}
+
+// WithRetriedCreates retries creates like other calls. Only use it against an
+// API with idempotency_window set, or a retried create may run twice
+func WithRetriedCreates() Option {
+	return func(c *Client) { c.retryCreates = true }
+}
+
+// New returns a client for the API at baseURL, e.g. "http://localhost:8080"
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		maxRetries: 3,
+		minBackoff: 200 * time.Millisecond,
+		maxBackoff: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Token returns the token the client is currently using, if any
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+func (c *Client) setToken(token string) {
+	c.mu.Lock()
+	c.token = token
+	c.mu.Unlock()
+}
+
+// Login exchanges credentials for a token and keeps it for later calls
+func (c *Client) Login(ctx context.Context, login, password string) (string, error) {
+	body := map[string]string{"username": login, "password": password}
+	if strings.Contains(login, "@") {
+		body = map[string]string{"email": login, "password": password}
+	}
+
+	var out struct {
+		Token string `json:"token"`
+	}
+	if err := c.send(ctx, http.MethodPost, "/v1/login", "", body, &out); err != nil {
+		return "", err
+	}
+
+	c.setToken(out.Token)
+	return out.Token, nil
+}
+
+// call runs a request that needs a token, logging in first if there is none
+// and once more if the token is rejected
+func (c *Client) call(ctx context.Context, method, path string, in, out any) error {
+	// every attempt at the same create shares one key
+	// the key goes on the request itself, never on the logins made for it
+	req := ctx
+	if method == http.MethodPost {
+		req = context.WithValue(ctx, idempotencyKey{}, crand.Text())
+	}
+
+	token := c.Token()
+	fresh := false
+	if token == "" && c.login != "" {
+		var err error
+		if token, err = c.Login(ctx, c.login, c.password); err != nil {
+			return err
+		}
+		fresh = true
+	}
+
+	err := c.send(req, method, path, token, in, out)
+
+	// a token that was just issued won't do any better the second time
+	var apiErr *Error
+	if c.login != "" && !fresh && errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized {
+		if token, err = c.Login(ctx, c.login, c.password); err != nil {
+			return err
+		}
+		return c.send(req, method, path, token, in, out)
+	}
+
+	return err
+}
+
+// send makes the request, retrying idempotent methods on temporary failures
+func (c *Client) send(ctx context.Context, method, path, token string, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	retries := 0
+	if _, keyed := ctx.Value(idempotencyKey{}).(string); keyed && c.retryCreates || idempotent(method) && !conditional(ctx) {
+		retries = c.maxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		res, err := c.do(ctx, method, path, token, body)
+		if err != nil {
+			if ctx.Err() != nil || attempt >= retries {
+				return err
+			}
+			if err := c.wait(ctx, attempt, ""); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if retryable(res.StatusCode) && attempt < retries {
+			retryAfter := res.Header.Get("Retry-After")
+			drain(res)
+			if err := c.wait(ctx, attempt, retryAfter); err != nil {
+				return err
+			}
+			continue
+		}
+
+		return decode(res, out)
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path, token string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if version, ok := ctx.Value(ifMatchKey{}).(int); ok && version != 0 {
+		req.Header.Set("If-Match", `"`+strconv.Itoa(version)+`"`)
+	}
+	if key, ok := ctx.Value(idempotencyKey{}).(string); ok {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+type (
+	ifMatchKey     struct{}
+	idempotencyKey struct{}
+)
+
+// ifMatch makes the requests made with ctx conditional on the item still being
+// at version, when it's non-zero
+func ifMatch(ctx context.Context, version int) context.Context {
+	return context.WithValue(ctx, ifMatchKey{}, version)
+}
+
+// conditional reports whether requests made with ctx carry If-Match
+func conditional(ctx context.Context) bool {
+	version, _ := ctx.Value(ifMatchKey{}).(int)
+	return version != 0
+}
+
+// wait sleeps before retry attempt+1, honouring Retry-After when it's given
+// in seconds and otherwise backing off exponentially with jitter
+func (c *Client) wait(ctx context.Context, attempt int, retryAfter string) error {
+	delay := c.minBackoff << attempt
+	if delay > c.maxBackoff || delay < c.minBackoff {
+		delay = c.maxBackoff
+	}
+	delay = delay/2 + rand.N(delay/2+1)
+
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func drain(res *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	res.Body.Close()
+}
+
+// decode reads a successful response into out, or turns an error response
+// into an *Error
+func decode(res *http.Response, out any) error {
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode >= 300 {
+		apiErr := &Error{Status: res.StatusCode}
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Code == "" {
+			apiErr.Code = CodeUnknown
+			apiErr.Detail = strings.TrimSpace(string(data))
+		}
+		apiErr.Status = res.StatusCode
+		return apiErr
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decoding %s response: %w", res.Request.URL.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/z-sk1/signin-api/internal/server"
+)
+
+func newServer(t *testing.T) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+
+	srv := httptest.NewServer(server.New(server.Options{Stores: server.MemoryStores(), JWTKey: []byte("test-secret")}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClient(t *testing.T) {
+	srv := newServer(t)
+	ctx := context.Background()
+
+	if err := New(srv.URL).SignUp(ctx, "sam", "sam@example.com", "hunter22"); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(srv.URL).SignUp(ctx, "sam", "sam@example.com", "hunter22"); !errors.Is(err, ErrAlreadyExists) {
+		t.Fatalf("duplicate signup: %v, want ErrAlreadyExists", err)
+	}
+
+	// no credentials, no token
+	if _, err := New(srv.URL).Me(ctx); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("anonymous Me: %v, want ErrUnauthorized", err)
+	}
+
+	c := New(srv.URL, WithCredentials("sam@example.com", "hunter22"))
+
+	me, err := c.Me(ctx)
+	if err != nil || me.Username != "sam" {
+		t.Fatalf("Me = %+v, %v", me, err)
+	}
+
+	note, err := c.CreateNote(ctx, Note{Title: "groceries", Content: "milk"})
+	if err != nil || note.ID == 0 || note.Version != 1 || note.Title != "groceries" {
+		t.Fatalf("CreateNote = %+v, %v", note, err)
+	}
+	notes, err := c.ListNotes(ctx, nil)
+	if err != nil || len(notes) != 1 || notes[0].Title != "groceries" {
+		t.Fatalf("ListNotes = %+v, %v", notes, err)
+	}
+
+	updated, err := c.UpdateNote(ctx, notes[0].ID, Note{Title: "shopping"})
+	if err != nil || updated.Title != "shopping" || updated.Content != "" {
+		t.Fatalf("UpdateNote = %+v, %v", updated, err)
+	}
+	patched, err := c.PatchNote(ctx, notes[0].ID, map[string]any{"content": "bread"})
+	if err != nil || patched.Title != "shopping" || patched.Content != "bread" {
+		t.Fatalf("PatchNote = %+v, %v", patched, err)
+	}
+	if got, err := c.GetNote(ctx, notes[0].ID); err != nil || *got != *patched {
+		t.Fatalf("GetNote = %+v, %v", got, err)
+	}
+
+	// a second device still holding the first version can't overwrite
+	stale := notes[0]
+	stale.Title = "stale"
+	if _, err := c.UpdateNote(ctx, stale.ID, stale); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("stale UpdateNote: %v, want ErrVersionMismatch", err)
+	}
+	if err := c.DeleteNote(ctx, notes[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteNote(ctx, notes[0].ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second delete: %v, want ErrNotFound", err)
+	}
+
+	due := time.Date(2030, 1, 2, 12, 0, 0, 0, time.UTC)
+	if _, err := c.CreateReminder(ctx, Reminder{Title: "dentist", Due: due}); err != nil {
+		t.Fatal(err)
+	}
+	reminders, err := c.ListReminders(ctx, nil)
+	if err != nil || len(reminders) != 1 || !reminders[0].Due.Equal(due) {
+		t.Fatalf("ListReminders = %+v, %v", reminders, err)
+	}
+
+	if _, err := c.CreateExpense(ctx, Expense{Amount: 12.5, Category: "food", Date: due, Currency: "EUR"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateExpense(ctx, Expense{Amount: 3, Category: "travel", Date: due}); err != nil {
+		t.Fatal(err)
+	}
+	food, err := c.ListExpenses(ctx, url.Values{"category": {"food"}})
+	if err != nil || len(food) != 1 || food[0].Currency != "EUR" {
+		t.Fatalf("ListExpenses = %+v, %v", food, err)
+	}
+
+	total, err := c.TotalExpenses(ctx)
+	if err != nil || total != 15.5 {
+		t.Fatalf("TotalExpenses = %v, %v", total, err)
+	}
+
+	_, err = c.CreateExpense(ctx, Expense{Amount: -1, Category: "food", Date: due})
+	var apiErr *Error
+	if !errors.Is(err, ErrValidation) || !errors.As(err, &apiErr) || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "amount" {
+		t.Fatalf("invalid expense: %v", err)
+	}
+	if apiErr.RequestID == "" {
+		t.Fatal("error is missing the request id")
+	}
+
+	results, err := c.Batch(ctx, []BatchOp{
+		{Method: "create", Resource: "expenses", Body: Expense{Amount: 3, Category: "travel", Date: due}},
+		{Method: "delete", Resource: "notes", ID: 999},
+	}, true)
+	var created Expense
+	if err != nil || len(results) != 2 || json.Unmarshal(results[0].Item, &created) != nil || created.Category != "travel" ||
+		!errors.Is(results[1].Error, ErrNotFound) {
+		t.Fatalf("Batch = %+v, %v", results, err)
+	}
+	if _, err := c.Batch(ctx, []BatchOp{{Method: "delete", Resource: "notes", ID: 999}}, false); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("all-or-nothing Batch: %v, want ErrNotFound", err)
+	}
+
+	hits, err := c.Search(ctx, "travel", "expenses")
+	if err != nil || len(hits) != 2 || hits[0].Type != "expenses" || !strings.Contains(hits[0].Snippet, "<mark>travel</mark>") {
+		t.Fatalf("Search = %+v, %v", hits, err)
+	}
+
+	if err := c.AddScore(ctx, LeaderboardEntry{Section: "a", Name: "x", Points: 1}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("AddScore as user: %v, want ErrForbidden", err)
+	}
+	if entries, err := c.Leaderboard(ctx, "a"); err != nil || entries == nil || len(entries) != 0 {
+		t.Fatalf("Leaderboard = %+v, %v; want no entries", entries, err)
+	}
+}
+
+func TestClientLogsInAgain(t *testing.T) {
+	srv := newServer(t)
+	ctx := context.Background()
+
+	if err := New(srv.URL).SignUp(ctx, "sam", "sam@example.com", "hunter22"); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(srv.URL, WithToken("stale"), WithCredentials("sam", "hunter22"))
+	if _, err := c.Me(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c.Token() == "stale" {
+		t.Fatal("token was not replaced")
+	}
+
+	wrong := New(srv.URL, WithCredentials("sam", "nope"))
+	if _, err := wrong.Me(ctx); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong password: %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestClientRetriesCreates(t *testing.T) {
+	api := newServer(t)
+
+	// the first create reaches the API but its response is lost on the way back
+	var lost, keyedLogin atomic.Bool
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/login" && r.Header.Get("Idempotency-Key") != "" {
+			keyedLogin.Store(true)
+		}
+		proxy, _ := http.NewRequestWithContext(r.Context(), r.Method, api.URL+r.URL.Path, r.Body)
+		proxy.Header = r.Header
+		res, err := http.DefaultClient.Do(proxy)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/notes" && !lost.Swap(true) {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+	}))
+	t.Cleanup(flaky.Close)
+
+	ctx := context.Background()
+	if err := New(api.URL).SignUp(ctx, "sam", "sam@example.com", "hunter22"); err != nil {
+		t.Fatal(err)
+	}
+	// by default a create isn't retried, as the API might not honour its key
+	c := New(flaky.URL, WithCredentials("sam", "hunter22"), WithRetries(3, time.Millisecond))
+	var apiErr *Error
+	if _, err := c.CreateNote(ctx, Note{Title: "groceries"}); !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadGateway {
+		t.Fatalf("CreateNote: %v, want the 502", err)
+	}
+	if notes, err := c.ListNotes(ctx, nil); err != nil || len(notes) != 1 {
+		t.Fatalf("ListNotes = %+v, %v; want the one note", notes, err)
+	}
+	lost.Store(false)
+
+	c = New(flaky.URL, WithCredentials("sam", "hunter22"), WithRetries(3, time.Millisecond), WithRetriedCreates())
+	if note, err := c.CreateNote(ctx, Note{Title: "groceries"}); err != nil || note.ID == 0 {
+		t.Fatalf("CreateNote should succeed after a retry: %+v, %v", note, err)
+	}
+	if keyedLogin.Load() {
+		t.Fatal("the login made for CreateNote carried its Idempotency-Key")
+	}
+	if notes, err := c.ListNotes(ctx, nil); err != nil || len(notes) != 2 {
+		t.Fatalf("ListNotes = %+v, %v; want two notes", notes, err)
+	}
+}
+
+func TestClientDoesNotRetryConditionalWrites(t *testing.T) {
+	api := newServer(t)
+
+	// the first two updates reach the API but their responses are lost on the
+	// way back
+	var puts atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxy, _ := http.NewRequestWithContext(r.Context(), r.Method, api.URL+r.URL.Path, r.Body)
+		proxy.Header = r.Header
+		res, err := http.DefaultClient.Do(proxy)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		if r.Method == http.MethodPut && puts.Add(1) <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+	}))
+	t.Cleanup(flaky.Close)
+
+	ctx := context.Background()
+	if err := New(api.URL).SignUp(ctx, "sam", "sam@example.com", "hunter22"); err != nil {
+		t.Fatal(err)
+	}
+	c := New(flaky.URL, WithCredentials("sam", "hunter22"), WithRetries(3, time.Millisecond))
+
+	note, err := c.CreateNote(ctx, Note{Title: "groceries"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	note.Title = "shopping"
+
+	// a retry would be told the note had changed, when the change was its own
+	_, err = c.UpdateNote(ctx, note.ID, *note)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadGateway || puts.Load() != 1 {
+		t.Fatalf("UpdateNote: %v after %d attempts, want the 502 after 1", err, puts.Load())
+	}
+
+	// without a version it's retried
+	note.Version = 0
+	if _, err := c.UpdateNote(ctx, note.ID, *note); err != nil || puts.Load() != 3 {
+		t.Fatalf("unconditional UpdateNote: %v after %d attempts", err, puts.Load())
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	api := newServer(t)
+
+	// fail the first two requests, then pass through to the API
+	var failures atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		proxy, _ := http.NewRequestWithContext(r.Context(), r.Method, api.URL+r.URL.Path, r.Body)
+		proxy.Header = r.Header
+		res, err := http.DefaultClient.Do(proxy)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+	}))
+	t.Cleanup(flaky.Close)
+
+	ctx := context.Background()
+	c := New(flaky.URL, WithRetries(3, time.Millisecond))
+
+	if _, err := c.Version(ctx); err != nil {
+		t.Fatalf("GET should succeed after retries: %v", err)
+	}
+	if got := failures.Load(); got != 3 {
+		t.Fatalf("%d requests, want 3", got)
+	}
+
+	// POSTs aren't idempotent so the first 503 is returned
+	failures.Store(0)
+	err := c.SignUp(ctx, "sam", "sam@example.com", "hunter22")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusServiceUnavailable {
+		t.Fatalf("POST: %v, want a 503", err)
+	}
+
+	// a cancelled context stops the retry loop
+	failures.Store(-100)
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := c.Version(cancelled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled: %v, want context.Canceled", err)
+	}
+}
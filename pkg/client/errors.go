@@ -0,0 +1,74 @@
+package client
+
+import "fmt"
+
+// codes the API reports in error responses
+const (
+	CodeInvalidRequest     = "invalid_request"
+	CodeValidationFailed   = "validation_failed"
+	CodeRequestTooLarge    = "request_too_large"
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidToken       = "invalid_token"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeAccountDisabled    = "account_disabled"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeAlreadyExists      = "already_exists"
+	CodeVersionMismatch    = "version_mismatch"
+	CodeIfMatchRequired    = "if_match_required"
+	CodeIdempotencyReused  = "idempotency_key_reused"
+	CodeIdempotencyInUse   = "idempotency_key_in_use"
+	CodeInvalidResetToken  = "invalid_reset_token"
+	CodeInvalidSetupToken  = "invalid_setup_token"
+	CodeSetupUnavailable   = "setup_unavailable"
+	CodeInternal           = "internal_error"
+	// CodeUnknown is used when the response wasn't a problem document
+	CodeUnknown = "unknown"
+)
+
+// Error is an error response from the API. Compare against the sentinels
+// with errors.Is, or read Code directly
+type Error struct {
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Detail    string       `json:"detail"`
+	RequestID string       `json:"request_id"`
+	Fields    []FieldError `json:"errors"`
+}
+
+// FieldError is one invalid field of a rejected request
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("signin-api: %d %s: %s", e.Status, e.Code, e.Detail)
+	for _, f := range e.Fields {
+		msg += fmt.Sprintf("; %s %s", f.Field, f.Message)
+	}
+	if e.RequestID != "" {
+		msg += " (request " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// Is matches sentinels by code, so errors.Is(err, ErrNotFound) works
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Status == 0 && t.Code == e.Code
+}
+
+var (
+	ErrValidation         = &Error{Code: CodeValidationFailed}
+	ErrUnauthorized       = &Error{Code: CodeUnauthorized}
+	ErrInvalidToken       = &Error{Code: CodeInvalidToken}
+	ErrInvalidCredentials = &Error{Code: CodeInvalidCredentials}
+	ErrAccountDisabled    = &Error{Code: CodeAccountDisabled}
+	ErrForbidden          = &Error{Code: CodeForbidden}
+	ErrNotFound           = &Error{Code: CodeNotFound}
+	ErrAlreadyExists      = &Error{Code: CodeAlreadyExists}
+	ErrVersionMismatch    = &Error{Code: CodeVersionMismatch}
+	ErrIdempotencyReused  = &Error{Code: CodeIdempotencyReused}
+)
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Note struct {
+	ID       int    `json:"id,omitempty"`
+	Username string `json:"username,omitempty"`
+	// Version is set on items read from the API. Updating an item with a
+	// non-zero Version fails with ErrVersionMismatch if it has changed since
+	Version   int       `json:"version,omitempty"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Reminder struct {
+	ID        int       `json:"id,omitempty"`
+	Username  string    `json:"username,omitempty"`
+	Version   int       `json:"version,omitempty"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Due       time.Time `json:"due"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Expense struct {
+	ID       int     `json:"id,omitempty"`
+	Username string  `json:"username,omitempty"`
+	Version  int     `json:"version,omitempty"`
+	Amount   float64 `json:"amount"`
+	// Currency is an ISO 4217 code; the API records USD when it's empty
+	Currency string    `json:"currency,omitempty"`
+	Category string    `json:"category"`
+	Date     time.Time `json:"date"`
+	Note     string    `json:"note"`
+}
+
+type CategoryTotal struct {
+	Category string  `json:"category"`
+	Total    float64 `json:"total"`
+}
+
+// BatchOp is one operation of a Batch
+type BatchOp struct {
+	// Method is "create", "update" or "delete"
+	Method string `json:"method"`
+	// Resource is "notes", "reminders" or "expenses"
+	Resource string `json:"resource"`
+	ID       int    `json:"id,omitempty"`
+	// Version makes an update or delete fail unless the item is still at it
+	Version int `json:"version,omitempty"`
+	// Body is the Note, Reminder or Expense to create or save
+	Body any `json:"body,omitempty"`
+}
+
+// BatchResult is the outcome of one BatchOp. Item holds the created or
+// updated item, to unmarshal into its type
+type BatchResult struct {
+	Status int             `json:"status"`
+	Item   json.RawMessage `json:"item,omitempty"`
+	Error  *Error          `json:"error,omitempty"`
+}
+
+// SearchHit is one item found by Search. Title is an expense's category, and
+// Snippet is escaped HTML that wraps each match in <mark></mark>
+type SearchHit struct {
+	Type    string  `json:"type"`
+	ID      int     `json:"id"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+type LeaderboardEntry struct {
+	ID      int    `json:"id,omitempty"`
+	Section string `json:"section"`
+	Name    string `json:"name"`
+	Points  int    `json:"points"`
+	Rank    int    `json:"rank,omitempty"`
+}
+
+// Profile is the signed-in user as returned by Me
+type Profile struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	Modified  bool   `json:"modified"`
+	GoVersion string `json:"go_version"`
+}
+
+// SetupRequest creates the first admin with the token printed at startup
+type SetupRequest struct {
+	Token    string `json:"token"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}